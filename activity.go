@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// addressVolumes is a sink summing the volume each address sent and received.
+// The zero address of mints and burns is left out.
+type addressVolumes struct {
+	volumes map[common.Address]*big.Int
+}
+
+func newAddressVolumes() *addressVolumes {
+	return &addressVolumes{volumes: make(map[common.Address]*big.Int)}
+}
+
+func (a *addressVolumes) Write(t Transfer) error {
+	if t.Event != EventTransfer {
+		return nil
+	}
+	for _, address := range []common.Address{t.From, t.To} {
+		if address == (common.Address{}) {
+			continue
+		}
+		volume, ok := a.volumes[address]
+		if !ok {
+			volume = new(big.Int)
+			a.volumes[address] = volume
+		}
+		volume.Add(volume, t.Amount)
+	}
+	return nil
+}
+
+func (a *addressVolumes) Close() error {
+	return nil
+}
+
+// activityReport scans the range and writes one {address, volume} row per
+// participating address, most active first, whatever the direction
+func activityReport(ctx context.Context, logs logFilterer, cfg scanConfig, opts outputOptions, w io.Writer, format string) error {
+	volumes := newAddressVolumes()
+	if _, err := getUSDCTransfers(ctx, logs, cfg, volumes); err != nil {
+		return err
+	}
+
+	addresses := make([]common.Address, 0, len(volumes.volumes))
+	for address := range volumes.volumes {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if c := volumes.volumes[addresses[i]].Cmp(volumes.volumes[addresses[j]]); c != 0 {
+			return c > 0
+		}
+		return addresses[i].Cmp(addresses[j]) < 0
+	})
+
+	rows := make([][]interface{}, len(addresses))
+	for i, address := range addresses {
+		rows[i] = []interface{}{address.Hex(), opts.reportAmount(format, volumes.volumes[address])}
+	}
+	return writeTable(w, format, []string{"address", "volume"}, rows)
+}
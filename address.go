@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The mainnet USDC proxy as published by Circle, EIP-55 checksummed. Kept
+// apart from USDC_CONTRACT_ADDRESS so an edit to either is caught at startup.
+const USDC_MAINNET_ADDRESS = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+
+// validateAddress checks that s is a 20 byte hex address and, if it is in
+// mixed case, that it carries a valid EIP-55 checksum. All-lowercase and
+// all-uppercase addresses have no checksum to verify.
+func validateAddress(s string) error {
+	if !common.IsHexAddress(s) {
+		return fmt.Errorf("Invalid address %q", s)
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if digits == strings.ToLower(digits) || digits == strings.ToUpper(digits) {
+		return nil
+	}
+	if checksummed := common.HexToAddress(s).Hex(); "0x"+digits != checksummed {
+		return fmt.Errorf("Address %q fails the EIP-55 checksum, is it mistyped? The checksummed form is %s", s, checksummed)
+	}
+	return nil
+}
+
+// looksLikeAddress reports whether s is meant as an address rather than a token symbol
+func looksLikeAddress(s string) bool {
+	return strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")
+}
+
+// verifyUSDCAddress checks USDC_CONTRACT_ADDRESS against the known-good
+// checksummed mainnet address, so a mistyped constant fails fast instead of
+// silently scanning another contract
+func verifyUSDCAddress() error {
+	if USDC_CONTRACT_ADDRESS != USDC_MAINNET_ADDRESS {
+		return fmt.Errorf("USDC_CONTRACT_ADDRESS %s isn't the mainnet USDC address %s", USDC_CONTRACT_ADDRESS, USDC_MAINNET_ADDRESS)
+	}
+	if checksummed := common.HexToAddress(USDC_CONTRACT_ADDRESS).Hex(); checksummed != USDC_CONTRACT_ADDRESS {
+		return fmt.Errorf("USDC_CONTRACT_ADDRESS %s isn't EIP-55 checksummed, expected %s", USDC_CONTRACT_ADDRESS, checksummed)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestUSDCAddressChecksum(t *testing.T) {
+	if err := verifyUSDCAddress(); err != nil {
+		t.Fatal(err)
+	}
+	if got := common.HexToAddress(USDC_CONTRACT_ADDRESS).Hex(); got != USDC_CONTRACT_ADDRESS {
+		t.Errorf("USDC_CONTRACT_ADDRESS = %s, want the EIP-55 form %s", USDC_CONTRACT_ADDRESS, got)
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	for _, tt := range []struct {
+		address string
+		ok      bool
+	}{
+		{USDC_MAINNET_ADDRESS, true},
+		{strings.ToLower(USDC_MAINNET_ADDRESS), true},
+		{"0x" + strings.ToUpper(USDC_MAINNET_ADDRESS[2:]), true},
+		{strings.Replace(USDC_MAINNET_ADDRESS, "A0b8", "a0B8", 1), false}, // case flipped
+		{USDC_MAINNET_ADDRESS[:41], false},
+		{"USDC", false},
+	} {
+		if err := validateAddress(tt.address); (err == nil) != tt.ok {
+			t.Errorf("validateAddress(%q) = %v, want ok %v", tt.address, err, tt.ok)
+		}
+	}
+}
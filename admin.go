@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// EIP-1967 admin slot: bytes32(uint256(keccak256("eip1967.proxy.admin")) - 1)
+const EIP1967_ADMIN_SLOT = "0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103"
+
+// Legacy ZeppelinOS admin slot used by the USDC proxy: keccak256("org.zeppelinos.proxy.admin")
+const ZOS_ADMIN_SLOT = "0x10d6a54a4754c8869d6886b5f5d7fbfa5b4522237ea5c60d11bc4e7a1ff9390b"
+
+// EIP-1967 implementation slot: bytes32(uint256(keccak256("eip1967.proxy.implementation")) - 1)
+const EIP1967_IMPLEMENTATION_SLOT = "0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"
+
+// Legacy ZeppelinOS implementation slot used by the USDC proxy: keccak256("org.zeppelinos.proxy.implementation")
+const ZOS_IMPLEMENTATION_SLOT = "0x7050c9e0f4ca769c69bd3a8ef740bc37934f8e2c036e5a723fd8ee048ed3f8c3"
+
+// storageReader is implemented by *ethclient.Client
+type storageReader interface {
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// proxySlot is a named storage slot holding an address
+type proxySlot struct {
+	name string
+	slot string
+}
+
+var (
+	adminSlots = []proxySlot{
+		{"EIP-1967 admin slot", EIP1967_ADMIN_SLOT},
+		{"ZeppelinOS admin slot", ZOS_ADMIN_SLOT},
+	}
+	implementationSlots = []proxySlot{
+		{"EIP-1967 implementation slot", EIP1967_IMPLEMENTATION_SLOT},
+		{"ZeppelinOS implementation slot", ZOS_IMPLEMENTATION_SLOT},
+	}
+)
+
+// readProxySlots returns the first non-zero address stored in slots and the name of its slot
+func readProxySlots(ctx context.Context, reader storageReader, address common.Address, slots []proxySlot) (common.Address, string, error) {
+	for _, s := range slots {
+		value, err := reader.StorageAt(ctx, address, common.HexToHash(s.slot), nil)
+		if err != nil {
+			return common.Address{}, "", rpcFailure(fmt.Errorf("Failed to read %s: %v", s.name, err))
+		}
+		if found := common.BytesToAddress(value); found != (common.Address{}) {
+			return found, s.name, nil
+		}
+	}
+	return common.Address{}, "", nil
+}
+
+// getProxyAdmin returns the proxy admin and where it was read from.
+// admin() only answers when called by the admin itself and reverts for
+// everyone else, so fall back to reading the admin storage slot directly.
+func getProxyAdmin(ctx context.Context, client *ethclient.Client, usdc USDC, address common.Address) (common.Address, string, error) {
+	admin, err := usdc.AdminCtx(ctx)
+	if err == nil {
+		return admin, "admin()", nil
+	}
+
+	admin, source, slotErr := readProxySlots(ctx, client, address, adminSlots)
+	if slotErr != nil {
+		return common.Address{}, "", slotErr
+	}
+	if source == "" {
+		return common.Address{}, "", fmt.Errorf("Failed to find proxy admin: admin() reverted (%v) and admin slots are empty", err)
+	}
+	return admin, source, nil
+}
+
+// proxyImplementation returns the implementation address of a proxy and the slot it was read from
+func proxyImplementation(ctx context.Context, reader storageReader, address common.Address) (common.Address, string, error) {
+	implementation, source, err := readProxySlots(ctx, reader, address, implementationSlots)
+	if err != nil {
+		return common.Address{}, "", err
+	}
+	if source == "" {
+		return common.Address{}, "", fmt.Errorf("%s has no implementation in the proxy slots", address.Hex())
+	}
+	return implementation, source, nil
+}
+
+// codeAtReader is implemented by *ethclient.Client
+type codeAtReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// codeCache remembers which addresses have contract code at the latest block.
+// A process talks to one chain, so the cache is kept per address for its lifetime.
+type codeCache struct {
+	mu    sync.Mutex
+	known map[common.Address]bool
+}
+
+// contractCodes is the code check cache shared by every lookup of the process
+var contractCodes = &codeCache{known: make(map[common.Address]bool)}
+
+// IsContract reports whether address has code, asking client only the first time
+func (c *codeCache) IsContract(ctx context.Context, client codeAtReader, address common.Address) (bool, error) {
+	c.mu.Lock()
+	isContract, ok := c.known[address]
+	c.mu.Unlock()
+	if ok {
+		return isContract, nil
+	}
+
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return false, err
+	}
+	isContract = len(code) > 0
+
+	c.mu.Lock()
+	c.known[address] = isContract
+	c.mu.Unlock()
+	return isContract, nil
+}
+
+// printProxyInfo prints the token name, symbol and proxy admin. In verbose
+// mode it also reports whether the admin is an EOA, which means a single key
+// can upgrade the token.
+func printProxyInfo(ctx context.Context, client *ethclient.Client, usdc USDC, address common.Address, verbose bool) error {
+	name, err := usdc.NameCtx(ctx)
+	if err != nil {
+		return rpcFailure(fmt.Errorf("Failed to get token name: %v", err))
+	}
+	symbol, err := usdc.SymbolCtx(ctx)
+	if err != nil {
+		return rpcFailure(fmt.Errorf("Failed to get token symbol: %v", err))
+	}
+	fmt.Printf("Token: %s (%s)\n", name, symbol)
+
+	admin, source, err := getProxyAdmin(ctx, client, usdc, address)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("USDC proxy admin: %s\n", admin.Hex())
+	if !verbose {
+		return nil
+	}
+	fmt.Printf("Proxy admin read via: %s\n", source)
+
+	isContract, err := contractCodes.IsContract(ctx, client, admin)
+	if err != nil {
+		return rpcFailure(fmt.Errorf("Failed to get proxy admin code: %v", err))
+	}
+	if isContract {
+		fmt.Println("Proxy admin type: contract (multisig/timelock)")
+	} else {
+		fmt.Println("Proxy admin type: EOA")
+		fmt.Println("WARNING: the proxy admin is an EOA, a single private key can upgrade the USDC implementation")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// countingCode answers CodeAt from code and counts the calls
+type countingCode struct {
+	code  map[common.Address][]byte
+	err   error
+	calls int
+}
+
+func (c *countingCode) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	c.calls++
+	return c.code[account], c.err
+}
+
+func TestCodeCache(t *testing.T) {
+	client := &countingCode{code: map[common.Address][]byte{testAlice: {0x00}}}
+	cache := &codeCache{known: make(map[common.Address]bool)}
+	for range 2 {
+		for address, want := range map[common.Address]bool{testAlice: true, testBob: false} {
+			isContract, err := cache.IsContract(context.Background(), client, address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isContract != want {
+				t.Errorf("IsContract(%s) = %v, want %v", address.Hex(), isContract, want)
+			}
+		}
+	}
+	if client.calls != 2 {
+		t.Errorf("%d CodeAt calls for two addresses looked up twice, want 2", client.calls)
+	}
+
+	// A failed lookup isn't cached
+	failing := &countingCode{err: errors.New("connection refused")}
+	addr := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	for range 2 {
+		if _, err := cache.IsContract(context.Background(), failing, addr); err == nil {
+			t.Fatal("IsContract swallowed the error")
+		}
+	}
+	if failing.calls != 2 {
+		t.Errorf("%d CodeAt calls after failures, want 2", failing.calls)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Overflow policies of a full sink buffer
+const (
+	OVERFLOW_BLOCK       = "block"
+	OVERFLOW_DROP_OLDEST = "drop-oldest"
+	OVERFLOW_DROP_NEWEST = "drop-newest"
+)
+
+// bufferConfig controls the buffering of each sink; a zero Size writes synchronously
+type bufferConfig struct {
+	Size   int
+	Policy string
+}
+
+func validOverflowPolicy(policy string) bool {
+	return policy == OVERFLOW_BLOCK || policy == OVERFLOW_DROP_OLDEST || policy == OVERFLOW_DROP_NEWEST
+}
+
+// bufferedSink writes to a sink from its own goroutine through a buffered
+// channel, so a slow sink doesn't stall the scan or the other sinks. When the
+// buffer is full, Write blocks or drops a record according to the policy.
+// Errors of the underlying sink are returned by a later Write or Close.
+type bufferedSink struct {
+	name   string
+	sink   Sink
+	policy string
+	ch     chan Transfer
+	done   chan struct{}
+
+	mu      sync.Mutex
+	err     error
+	dropped int
+}
+
+func newBufferedSink(name string, sink Sink, cfg bufferConfig) *bufferedSink {
+	b := &bufferedSink{
+		name:   name,
+		sink:   sink,
+		policy: cfg.Policy,
+		ch:     make(chan Transfer, cfg.Size),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *bufferedSink) run() {
+	defer close(b.done)
+	for t := range b.ch {
+		if err := b.sink.Write(t); err != nil {
+			b.mu.Lock()
+			if b.err == nil {
+				b.err = err
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+func (b *bufferedSink) Write(t Transfer) error {
+	b.mu.Lock()
+	err := b.err
+	b.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("%s: %v", b.name, err)
+	}
+
+	switch b.policy {
+	case OVERFLOW_DROP_NEWEST:
+		select {
+		case b.ch <- t:
+		default:
+			b.drop()
+		}
+	case OVERFLOW_DROP_OLDEST:
+		for {
+			select {
+			case b.ch <- t:
+				return nil
+			default:
+			}
+			select {
+			case <-b.ch:
+				b.drop()
+			default:
+			}
+		}
+	default:
+		b.ch <- t
+	}
+	return nil
+}
+
+func (b *bufferedSink) drop() {
+	b.mu.Lock()
+	b.dropped++
+	b.mu.Unlock()
+}
+
+// Close drains the buffer into the sink and closes it
+func (b *bufferedSink) Close() error {
+	close(b.ch)
+	<-b.done
+	closeErr := b.sink.Close()
+	if b.err != nil {
+		return fmt.Errorf("%s: %v", b.name, b.err)
+	}
+	return closeErr
+}
+
+// droppedRecords returns the records dropped by the buffered sinks in sink, by sink name
+func droppedRecords(sink Sink) map[string]int {
+	dropped := make(map[string]int)
+	countDropped(sink, dropped)
+	return dropped
+}
+
+func countDropped(sink Sink, dropped map[string]int) {
+	switch s := sink.(type) {
+	case multiSink:
+		for _, child := range s {
+			countDropped(child, dropped)
+		}
+	case *pipeline:
+		for _, h := range s.handlers {
+			if sh, ok := h.(sinkHandler); ok {
+				countDropped(sh.sink, dropped)
+			}
+		}
+	case *bufferedSink:
+		s.mu.Lock()
+		if s.dropped > 0 {
+			dropped[s.name] += s.dropped
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// callMethod calls a read-only method of the USDC ABI given by its signature,
+// e.g. "balanceOf(address)", and prints the decoded outputs. The arguments are
+// checked against the ABI input types before anything is sent.
+func callMethod(ctx context.Context, client *ethclient.Client, address common.Address, signature string, args []string) error {
+	parsed, err := abi.JSON(strings.NewReader(USDCABI))
+	if err != nil {
+		return err
+	}
+	method, err := findMethod(parsed, signature)
+	if err != nil {
+		return err
+	}
+	if !method.IsConstant() {
+		return badInput(fmt.Errorf("%s is not a read-only method", method.Sig))
+	}
+	if len(args) != len(method.Inputs) {
+		return badInput(fmt.Errorf("%s takes %d arguments, got %d", method.Sig, len(method.Inputs), len(args)))
+	}
+
+	values := make([]interface{}, len(args))
+	for i, input := range method.Inputs {
+		values[i], err = parseArg(input.Type, strings.TrimSpace(args[i]))
+		if err != nil {
+			return badInput(fmt.Errorf("Invalid argument %d (%s %s): %v", i+1, input.Type, input.Name, err))
+		}
+	}
+
+	data, err := parsed.Pack(method.Name, values...)
+	if err != nil {
+		return err
+	}
+	result, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return withRevertReason(err)
+	}
+	outputs, err := method.Outputs.Unpack(result)
+	if err != nil {
+		return fmt.Errorf("Failed to decode result: %v", err)
+	}
+
+	for i, output := range method.Outputs {
+		name := output.Name
+		if name == "" {
+			name = fmt.Sprintf("output%d", i)
+		}
+		fmt.Printf("%s (%s): %s\n", name, output.Type, formatValue(outputs[i]))
+	}
+	return nil
+}
+
+// findMethod looks up a method by signature, or by bare name if that is unambiguous
+func findMethod(parsed abi.ABI, signature string) (abi.Method, error) {
+	signature = strings.ReplaceAll(signature, " ", "")
+	var byName []abi.Method
+	for _, method := range parsed.Methods {
+		if method.Sig == signature {
+			return method, nil
+		}
+		if method.RawName == signature {
+			byName = append(byName, method)
+		}
+	}
+	if len(byName) == 1 {
+		return byName[0], nil
+	}
+	if len(byName) > 1 {
+		return abi.Method{}, badInput(fmt.Errorf("%s is overloaded, use the full signature", signature))
+	}
+	return abi.Method{}, badInput(fmt.Errorf("Method %s not found in the ABI", signature))
+}
+
+// parseArg converts a command line argument to the Go value the ABI packer expects for t
+func parseArg(t abi.Type, s string) (interface{}, error) {
+	switch t.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("not a hex address")
+		}
+		return common.HexToAddress(s), nil
+	case abi.UintTy, abi.IntTy:
+		n, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			return nil, fmt.Errorf("not an integer")
+		}
+		if t.T == abi.UintTy && n.Sign() < 0 {
+			return nil, fmt.Errorf("negative value for unsigned type")
+		}
+		bits := n.BitLen()
+		if t.T == abi.IntTy {
+			// Two's complement: -2^(size-1) takes as many bits as 2^(size-1)-1
+			m := n
+			if n.Sign() < 0 {
+				m = new(big.Int).Not(n)
+			}
+			bits = m.BitLen() + 1
+		}
+		if bits > t.Size {
+			return nil, fmt.Errorf("value out of range")
+		}
+		if t.Size > 64 {
+			return n, nil
+		}
+		v := reflect.New(t.GetType()).Elem()
+		if t.T == abi.UintTy {
+			v.SetUint(n.Uint64())
+		} else {
+			v.SetInt(n.Int64())
+		}
+		return v.Interface(), nil
+	case abi.BoolTy:
+		return strconv.ParseBool(s)
+	case abi.StringTy:
+		return s, nil
+	case abi.BytesTy:
+		return hexutil.Decode(s)
+	case abi.FixedBytesTy:
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != t.Size {
+			return nil, fmt.Errorf("expected %d bytes, got %d", t.Size, len(b))
+		}
+		v := reflect.New(t.GetType()).Elem()
+		reflect.Copy(v, reflect.ValueOf(b))
+		return v.Interface(), nil
+	}
+	return nil, fmt.Errorf("unsupported argument type %s", t)
+}
+
+// formatValue formats a decoded ABI value for display
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case common.Address:
+		return v.Hex()
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return hexutil.Encode(v)
+	case [32]byte:
+		return hexutil.Encode(v[:])
+	}
+	return fmt.Sprint(v)
+}
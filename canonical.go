@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// canonicalTransfer is a jsonTransfer encoded canonically: keys sorted,
+// integers in base 10, amounts and hashes as strings and no whitespace, so a
+// record is byte-identical across runs and Go versions. An empty Amount is
+// left out.
+type canonicalTransfer jsonTransfer
+
+func (c canonicalTransfer) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	field := func(key string, value []byte) {
+		if buf.Len() == 0 {
+			buf.WriteByte('{')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.Quote(key))
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	text := func(s string) []byte {
+		data, _ := json.Marshal(s)
+		return data
+	}
+
+	// Keep in sorted key order
+	if c.Amount != "" {
+		field("amount", text(c.Amount))
+	}
+	field("amount_raw", text(c.AmountRaw))
+	field("block", strconv.AppendUint(nil, c.Block, 10))
+	field("from", text(c.From))
+	field("log_index", strconv.AppendUint(nil, uint64(c.LogIndex), 10))
+	field("to", text(c.To))
+	field("tx_hash", text(c.TxHash))
+	field("type", text(c.Type))
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
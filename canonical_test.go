@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCanonicalTransferBytes(t *testing.T) {
+	transfer := Transfer{
+		Event:       EventTransfer,
+		Type:        "Transfer",
+		BlockNumber: 19_000_000,
+		TxHash:      common.HexToHash("0xab"),
+		LogIndex:    7,
+		From:        testAlice,
+		To:          testBob,
+		Amount:      big.NewInt(1_234_567),
+	}
+	want := `{"amount":"1.234567","amount_raw":"1234567","block":19000000,` +
+		`"from":"0x1111111111111111111111111111111111111111","log_index":7,` +
+		`"to":"0x2222222222222222222222222222222222222222",` +
+		`"tx_hash":"0x00000000000000000000000000000000000000000000000000000000000000ab","type":"Transfer"}`
+
+	data, err := canonicalTransfer(newJSONTransfer(transfer, 6)).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("canonical json = %s\nwant %s", data, want)
+	}
+	record, err := encodeTransfer(FORMAT_NDJSON, transfer, outputOptions{Decimals: 6, CanonicalJSON: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(record) != want+"\n" {
+		t.Errorf("-canonical-json record = %s, want the canonical json and a newline", record)
+	}
+
+	// Pinned, as the checksums of earlier runs must stay comparable
+	sum := &checksumSink{}
+	sum.Write(transfer)
+	if got := sum.Sum().Hex(); got != "0x7b0ab39e84666c1642a2d2d4e79488bc9c7b98e8f397b40ea3b4ede1c239cf18" {
+		t.Errorf("checksum = %s, want the pinned checksum", got)
+	}
+}
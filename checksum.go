@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// checksumSink hashes every record it receives into a deterministic
+// checksum of the result set, to compare runs across providers
+type checksumSink struct {
+	records []Transfer
+}
+
+func (c *checksumSink) Write(t Transfer) error {
+	c.records = append(c.records, t)
+	return nil
+}
+
+func (c *checksumSink) Close() error {
+	return nil
+}
+
+// Sum returns the keccak256 of the canonical json of all records, sorted by
+// block and log index and joined with "\n". The decimal amount is left out
+// of the records, so the checksum doesn't depend on -decimals, -precision or
+// the output format.
+func (c *checksumSink) Sum() common.Hash {
+	sort.Slice(c.records, func(i, j int) bool {
+		a, b := c.records[i], c.records[j]
+		if a.BlockNumber != b.BlockNumber {
+			return a.BlockNumber < b.BlockNumber
+		}
+		return a.LogIndex < b.LogIndex
+	})
+	lines := make([][]byte, len(c.records))
+	for i, t := range c.records {
+		record := newJSONTransfer(t, 0)
+		record.Amount = ""
+		lines[i], _ = canonicalTransfer(record).MarshalJSON()
+	}
+	return crypto.Keccak256Hash(bytes.Join(lines, []byte("\n")))
+}
+
+// withChecksum also feeds sink's records into a checksumSink if enabled;
+// the returned checksum is nil otherwise
+func withChecksum(sink Sink, enabled bool) (Sink, *checksumSink) {
+	if !enabled {
+		return sink, nil
+	}
+	c := &checksumSink{}
+	return multiSink{sink, c}, c
+}
+
+// printChecksum prints the checksum of the records collected by c, if any
+func printChecksum(c *checksumSink) {
+	if c == nil {
+		return
+	}
+	fmt.Fprintf(infoOut, "Checksum: %s (%d records)\n", c.Sum().Hex(), len(c.records))
+}
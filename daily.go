@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// blockTotals is a sink that sums transfer counts and volume per block
+type blockTotals struct {
+	blocks map[uint64]*blockTotal
+}
+
+type blockTotal struct {
+	Count  int
+	Volume *big.Int
+}
+
+func newBlockTotals() *blockTotals {
+	return &blockTotals{blocks: make(map[uint64]*blockTotal)}
+}
+
+func (b *blockTotals) Write(t Transfer) error {
+	if t.Event != EventTransfer {
+		return nil
+	}
+	total, ok := b.blocks[t.BlockNumber]
+	if !ok {
+		total = &blockTotal{Volume: new(big.Int)}
+		b.blocks[t.BlockNumber] = total
+	}
+	total.Count++
+	total.Volume.Add(total.Volume, t.Amount)
+	return nil
+}
+
+func (b *blockTotals) Close() error {
+	return nil
+}
+
+// blockTimes caches block timestamps
+type blockTimes struct {
+	client *ethclient.Client
+	cache  map[uint64]uint64
+}
+
+func newBlockTimes(client *ethclient.Client) *blockTimes {
+	return &blockTimes{client: client, cache: make(map[uint64]uint64)}
+}
+
+// Time returns the timestamp of a block
+func (b *blockTimes) Time(ctx context.Context, number uint64) (uint64, error) {
+	if t, ok := b.cache[number]; ok {
+		return t, nil
+	}
+	header, err := b.client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return 0, rpcFailure(fmt.Errorf("Failed to get block %d: %v", number, err))
+	}
+	b.cache[number] = header.Time
+	return header.Time, nil
+}
+
+// dayStart is the first block of a UTC day within a range
+type dayStart struct {
+	Date  string
+	Block uint64
+}
+
+// dayBoundaries returns the first block of every UTC day overlapping [start, end].
+// Timestamps grow with block numbers, so each boundary is found by binary search
+// and only O(days * log(blocks)) headers are fetched.
+func dayBoundaries(ctx context.Context, times *blockTimes, start uint64, end uint64) ([]dayStart, error) {
+	startTime, err := times.Time(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	endTime, err := times.Time(ctx, end)
+	if err != nil {
+		return nil, err
+	}
+
+	t := time.Unix(int64(startTime), 0).UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	days := []dayStart{{Date: day.Format("2006-01-02"), Block: start}}
+
+	lo := start
+	for {
+		day = day.AddDate(0, 0, 1)
+		if int64(endTime) < day.Unix() {
+			return days, nil
+		}
+
+		// First block in (lo, end] with a timestamp at or after midnight
+		l, h := lo+1, end
+		for l < h {
+			m := l + (h-l)/2
+			mt, err := times.Time(ctx, m)
+			if err != nil {
+				return nil, err
+			}
+			if int64(mt) >= day.Unix() {
+				h = m
+			} else {
+				l = m + 1
+			}
+		}
+		days = append(days, dayStart{Date: day.Format("2006-01-02"), Block: l})
+		lo = l
+	}
+}
+
+// sumByDay scans the range and writes one {date, count, volume} row per UTC day
+func sumByDay(ctx context.Context, client *ethclient.Client, logs logFilterer, cfg scanConfig, opts outputOptions, w io.Writer, format string) error {
+	totals := newBlockTotals()
+	if _, err := getUSDCTransfers(ctx, logs, cfg, totals); err != nil {
+		return err
+	}
+
+	days, err := dayBoundaries(ctx, newBlockTimes(client), cfg.StartBlock, cfg.EndBlock)
+	if err != nil {
+		return err
+	}
+	counts := make([]int, len(days))
+	volumes := make([]*big.Int, len(days))
+	for i := range volumes {
+		volumes[i] = new(big.Int)
+	}
+	for block, total := range totals.blocks {
+		i := sort.Search(len(days), func(i int) bool { return days[i].Block > block }) - 1
+		counts[i] += total.Count
+		volumes[i].Add(volumes[i], total.Volume)
+	}
+
+	rows := make([][]interface{}, len(days))
+	for i, day := range days {
+		rows[i] = []interface{}{day.Date, counts[i], opts.reportAmount(format, volumes[i])}
+	}
+	return writeTable(w, format, []string{"date", "count", "volume"}, rows)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// parseRawLogs parses the input of the decode command: json eth_getLogs log
+// objects (one, several, or an array as written by -save-raw-logs), or hex
+// words separated by spaces or commas, the topics followed by the data
+func parseRawLogs(input []byte) ([]types.Log, bool, error) {
+	input = bytes.TrimSpace(input)
+	if len(input) == 0 {
+		return nil, false, fmt.Errorf("No log given")
+	}
+
+	if input[0] == '{' || input[0] == '[' {
+		var logs []types.Log
+		dec := json.NewDecoder(bytes.NewReader(input))
+		for i := 1; dec.More(); i++ {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil, true, fmt.Errorf("Malformed json: %v", err)
+			}
+			if bytes.HasPrefix(value, []byte("[")) {
+				var batch []types.Log
+				if err := json.Unmarshal(value, &batch); err != nil {
+					return nil, true, fmt.Errorf("Malformed log in json array: %v", err)
+				}
+				logs = append(logs, batch...)
+				continue
+			}
+			var vLog types.Log
+			if err := json.Unmarshal(value, &vLog); err != nil {
+				return nil, true, fmt.Errorf("Malformed json log %d: %v", i, err)
+			}
+			logs = append(logs, vLog)
+		}
+		return logs, true, nil
+	}
+
+	words := strings.FieldsFunc(string(input), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(words) < 2 {
+		return nil, false, fmt.Errorf("Expected the topics followed by the data, got %d hex words", len(words))
+	}
+	var vLog types.Log
+	for i, word := range words {
+		data, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(word, "0x"), "0X"))
+		if err != nil {
+			return nil, false, fmt.Errorf("Word %d %q isn't hex: %v", i+1, word, err)
+		}
+		if i == len(words)-1 {
+			vLog.Data = data
+			break
+		}
+		if len(data) != common.HashLength {
+			return nil, false, fmt.Errorf("Topic %d is %d bytes, expected %d", i+1, len(data), common.HashLength)
+		}
+		vLog.Topics = append(vLog.Topics, common.BytesToHash(data))
+	}
+	return []types.Log{vLog}, false, nil
+}
+
+// decodeCommand decodes logs given as args, or read from stdin without args,
+// with the scanner's decoding and prints the records; no RPC is involved.
+// Text output lists the fields, csv and ndjson use the scan's record formats.
+func decodeCommand(args []string, stdin io.Reader, w io.Writer, format string, opts outputOptions) error {
+	var input []byte
+	if len(args) > 0 {
+		input = []byte(strings.Join(args, " "))
+	} else {
+		var err error
+		if input, err = io.ReadAll(stdin); err != nil {
+			return fmt.Errorf("Failed to read stdin: %v", err)
+		}
+	}
+	logs, full, err := parseRawLogs(input)
+	if err != nil {
+		return err
+	}
+
+	if format == FORMAT_CSV {
+		header, _ := encodeCSV(csvHeader)
+		w.Write(header)
+	}
+	for i, vLog := range logs {
+		t, err := decodeLog(vLog)
+		if err == errUnexpectedTopics {
+			return fmt.Errorf("Log %d isn't a standard Transfer or Approval: expected 3 topics starting with %s or %s, got %d topics", i+1, transferTopic.Hex(), approvalTopic.Hex(), len(vLog.Topics))
+		}
+		if err != nil {
+			return fmt.Errorf("Log %d: %v", i+1, err)
+		}
+		if format != FORMAT_TEXT {
+			record, err := encodeTransfer(format, t, opts)
+			if err != nil {
+				return err
+			}
+			w.Write(record)
+			continue
+		}
+
+		fmt.Fprintf(w, "Event: %s\n", t.Event)
+		fmt.Fprintf(w, "Type: %s\n", t.Type)
+		if t.Event == EventApproval {
+			fmt.Fprintf(w, "Owner: %s\nSpender: %s\n", t.From.Hex(), t.To.Hex())
+		} else {
+			fmt.Fprintf(w, "From: %s\nTo: %s\n", t.From.Hex(), t.To.Hex())
+		}
+		fmt.Fprintf(w, "Amount: %s %s (raw %s)\n", opts.textAmount(t.Amount), opts.Symbol, t.Amount)
+		if full {
+			fmt.Fprintf(w, "Contract: %s\n", vLog.Address.Hex())
+			fmt.Fprintf(w, "Block: %d\nTx: %s\nLog index: %d\n", vLog.BlockNumber, vLog.TxHash.Hex(), vLog.Index)
+			if vLog.Address != common.HexToAddress(USDC_CONTRACT_ADDRESS) {
+				fmt.Fprintf(w, "Note: the log wasn't emitted by the USDC contract\n")
+			}
+		}
+		if i < len(logs)-1 {
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrNoCode is returned by DeploymentBlock for addresses without code at the head
+var ErrNoCode = errors.New("no contract code")
+
+// codeReader is implemented by *ethclient.Client and the simulated backend's client
+type codeReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// DeploymentBlock returns the first block at which addr has code, searching
+// between 0 and the current head. It needs an archive node for old blocks,
+// and assumes the code was never removed and redeployed in between. An
+// address without code at the head returns an error wrapping ErrNoCode.
+func DeploymentBlock(ctx context.Context, client codeReader, addr common.Address) (uint64, error) {
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return 0, rpcFailure(fmt.Errorf("Failed to get the latest block number: %v", err))
+	}
+	return deploymentBlockAt(ctx, client, addr, head)
+}
+
+// deploymentBlockAt is DeploymentBlock with a given head
+func deploymentBlockAt(ctx context.Context, client codeReader, addr common.Address, head uint64) (uint64, error) {
+	code, err := client.CodeAt(ctx, addr, new(big.Int).SetUint64(head))
+	if err != nil {
+		return 0, rpcFailure(fmt.Errorf("Failed to get the code at block %d: %v", head, err))
+	}
+	if len(code) == 0 {
+		return 0, fmt.Errorf("%w at %s in block %d: it is not a contract, or not deployed on this chain", ErrNoCode, addr.Hex(), head)
+	}
+
+	// Invariant: code at high, none before low
+	low, high := uint64(0), head
+	for low < high {
+		mid := low + (high-low)/2
+		code, err := client.CodeAt(ctx, addr, new(big.Int).SetUint64(mid))
+		if err != nil {
+			return 0, rpcFailure(fmt.Errorf("Failed to get the code at block %d: %v", mid, err))
+		}
+		if len(code) > 0 {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return low, nil
+}
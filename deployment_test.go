@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestDeploymentBlock(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployer := crypto.PubkeyToAddress(key.PublicKey)
+	backend := simulated.NewBackend(types.GenesisAlloc{deployer: {Balance: big.NewInt(params.Ether)}})
+	defer backend.Close()
+	client := backend.Client()
+	ctx := context.Background()
+
+	for range 7 {
+		backend.Commit()
+	}
+	// Init code returning one byte of runtime code, deployed in block 8
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(chainID), &types.LegacyTx{
+		Gas:      100_000,
+		GasPrice: big.NewInt(params.GWei * 10),
+		Data:     []byte{0x60, 0x01, 0x60, 0x00, 0xf3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+	for range 5 {
+		backend.Commit()
+	}
+	contract := crypto.CreateAddress(deployer, 0)
+
+	block, err := DeploymentBlock(ctx, client, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block != 8 {
+		t.Errorf("DeploymentBlock = %d, want 8", block)
+	}
+
+	if _, err := DeploymentBlock(ctx, client, deployer); !errors.Is(err, ErrNoCode) {
+		t.Errorf("DeploymentBlock of an account without code: err = %v, want ErrNoCode", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// discoverEvents scans every log of the token in the range, whatever its
+// topics, and writes one {topic, event, count} row per distinct first topic,
+// most frequent first. Topics matching an event of the ABI are named by its
+// signature, others are "unknown"; logs without topics are tallied as "none".
+func discoverEvents(ctx context.Context, logs logFilterer, cfg scanConfig, w io.Writer, format string) error {
+	query := ethereum.FilterQuery{Addresses: []common.Address{cfg.Token}}
+	counts := make(map[string]int)
+	names := make(map[string]string)
+	err := forEachChunk(cfg.StartBlock, cfg.EndBlock, cfg.ChunkSize, func(from uint64, to uint64) error {
+		chunk, err := fetchChunk(ctx, logs, query, from, to, cfg.RetryOnEmpty)
+		if err != nil {
+			return err
+		}
+		for _, vLog := range chunk {
+			topic, name := "none", "anonymous"
+			if len(vLog.Topics) > 0 {
+				topic, name = vLog.Topics[0].Hex(), "unknown"
+				if event, err := usdcABI.EventByID(vLog.Topics[0]); err == nil {
+					name = event.Sig
+				}
+			}
+			counts[topic]++
+			names[topic] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	topics := make([]string, 0, len(counts))
+	for topic := range counts {
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if counts[topics[i]] != counts[topics[j]] {
+			return counts[topics[i]] > counts[topics[j]]
+		}
+		return topics[i] < topics[j]
+	})
+
+	rows := make([][]interface{}, len(topics))
+	for i, topic := range topics {
+		rows[i] = []interface{}{topic, names[topic], counts[topic]}
+	}
+	return writeTable(w, format, []string{"topic", "event", "count"}, rows)
+}
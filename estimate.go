@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Sub-ranges sampled by -estimate
+const ESTIMATE_SAMPLES = 5
+
+// logEstimate is the result of an -estimate preflight
+type logEstimate struct {
+	Transfers uint64
+	Approvals uint64
+	Exact     bool // the samples covered the whole range
+
+	Samples       int
+	SampleBlocks  uint64 // blocks per sample
+	SampledBlocks uint64
+	RangeBlocks   uint64
+	Found         int // logs in the samples
+}
+
+// estimateLogs extrapolates the number of logs in the scan range from
+// ESTIMATE_SAMPLES evenly spaced sub-ranges of one chunk each, assuming a
+// uniform log density. eth_getLogs has no count-only variant, so the samples
+// are downloaded; ranges that fit in the samples are simply counted.
+func estimateLogs(ctx context.Context, logs logFilterer, cfg scanConfig) (*logEstimate, error) {
+	query := cfg.filterQuery()
+	span := cfg.EndBlock - cfg.StartBlock + 1
+	est := &logEstimate{RangeBlocks: span, SampleBlocks: cfg.ChunkSize, Samples: ESTIMATE_SAMPLES}
+
+	var starts []uint64
+	if span <= cfg.ChunkSize*ESTIMATE_SAMPLES {
+		est.Exact = true
+		est.Samples = 0
+		forEachChunk(cfg.StartBlock, cfg.EndBlock, cfg.ChunkSize, func(from uint64, to uint64) error {
+			starts = append(starts, from)
+			est.Samples++
+			return nil
+		})
+	} else {
+		// Spread the samples over the range, the first at its start and the last at its end
+		for i := uint64(0); i < ESTIMATE_SAMPLES; i++ {
+			starts = append(starts, cfg.StartBlock+(span-cfg.ChunkSize)*i/(ESTIMATE_SAMPLES-1))
+		}
+	}
+
+	var transfers, approvals uint64
+	for _, from := range starts {
+		to := min(from+cfg.ChunkSize-1, cfg.EndBlock)
+		chunk, err := fetchChunk(ctx, logs, query, from, to, cfg.RetryOnEmpty)
+		if err != nil {
+			return nil, err
+		}
+		est.SampledBlocks += to - from + 1
+		for _, vLog := range chunk {
+			if len(vLog.Topics) > 0 && vLog.Topics[0] == approvalTopic {
+				approvals++
+			} else {
+				transfers++
+			}
+		}
+		est.Found += len(chunk)
+	}
+
+	est.Transfers = transfers * span / est.SampledBlocks
+	est.Approvals = approvals * span / est.SampledBlocks
+	return est, nil
+}
+
+// printEstimate prints an estimate along with how it was obtained
+func printEstimate(w io.Writer, est *logEstimate, cfg scanConfig) {
+	if est.Exact {
+		fmt.Fprintf(w, "%d transfers expected in blocks %d..%d (exact: the range was counted in %d chunks)\n",
+			est.Transfers, cfg.StartBlock, cfg.EndBlock, est.Samples)
+	} else {
+		fmt.Fprintf(w, "~%d transfers expected in blocks %d..%d (estimate: %d logs in %d evenly spaced samples of %d blocks, %d of %d blocks (%.2f%%), extrapolated assuming a uniform density)\n",
+			est.Transfers, cfg.StartBlock, cfg.EndBlock, est.Found, est.Samples, est.SampleBlocks,
+			est.SampledBlocks, est.RangeBlocks, 100*float64(est.SampledBlocks)/float64(est.RangeBlocks))
+	}
+	if cfg.WithApprovals {
+		if est.Exact {
+			fmt.Fprintf(w, "%d approvals expected\n", est.Approvals)
+		} else {
+			fmt.Fprintf(w, "~%d approvals expected\n", est.Approvals)
+		}
+	}
+	if len(cfg.Filters) > 0 {
+		fmt.Fprintln(w, "Client-side filters aren't taken into account")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Exit codes, so scripts can tell "no results" from a failure without parsing output
+const (
+	EXIT_OK          = 0
+	EXIT_FAILURE     = 1 // anything not covered below, e.g. an output file that can't be created
+	EXIT_EMPTY       = 3 // success, but no transfers matched
+	EXIT_RPC         = 4 // RPC or network error
+	EXIT_BAD_INPUT   = 5 // invalid flags, arguments or input files
+	EXIT_INTERRUPTED = 6 // cancelled by SIGINT/SIGTERM
+)
+
+// Cleanups such as flushing traces; os.Exit skips deferred calls, so exit
+// runs them itself
+var exitHooks []func()
+
+// atExit registers fn to run when main returns or the process exits through exit or fatalf
+func atExit(fn func()) {
+	exitHooks = append(exitHooks, fn)
+}
+
+// runExitHooks runs the exit hooks once, last registered first
+func runExitHooks() {
+	for i := len(exitHooks) - 1; i >= 0; i-- {
+		exitHooks[i]()
+	}
+	exitHooks = nil
+}
+
+// exit runs the exit hooks and exits with code
+func exit(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
+// fatalf logs like log.Fatalf but exits with code
+func fatalf(code int, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	exit(code)
+}
+
+// Error classes for failureCode. Errors are marked with rpcFailure or
+// badInput, which keep their message.
+var (
+	errRPC      = errors.New("RPC error")
+	errBadInput = errors.New("bad input")
+)
+
+// classifiedError marks err as belonging to class
+type classifiedError struct {
+	err   error
+	class error
+}
+
+func (e *classifiedError) Error() string        { return e.err.Error() }
+func (e *classifiedError) Unwrap() error        { return e.err }
+func (e *classifiedError) Is(target error) bool { return target == e.class }
+
+// rpcFailure marks err as an error of the node or the network
+func rpcFailure(err error) error {
+	return &classifiedError{err: err, class: errRPC}
+}
+
+// badInput marks err as caused by invalid flags, arguments or input files
+func badInput(err error) error {
+	return &classifiedError{err: err, class: errBadInput}
+}
+
+// isTransportError reports whether err came unwrapped from an RPC call: a
+// JSON-RPC error response, an HTTP error status, a network error or a call
+// timeout
+func isTransportError(err error) bool {
+	// Not net.Error: syscall.Errno implements it too, so a full disk would match
+	var rpcErr rpc.Error
+	var httpErr rpc.HTTPError
+	var opErr *net.OpError
+	var urlErr *url.Error
+	return errors.As(err, &rpcErr) || errors.As(err, &httpErr) || errors.As(err, &opErr) || errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// failureCode classifies err: a cancelled ctx means the run was interrupted,
+// then bad input and RPC errors get their codes and anything else, such as a
+// failed output or a handler error, is EXIT_FAILURE
+func failureCode(ctx context.Context, err error) int {
+	switch {
+	case ctx.Err() != nil:
+		return EXIT_INTERRUPTED
+	case errors.Is(err, errBadInput) || errors.Is(err, ErrNoCode):
+		return EXIT_BAD_INPUT
+	case errors.Is(err, errRPC) || isTransportError(err):
+		return EXIT_RPC
+	}
+	return EXIT_FAILURE
+}
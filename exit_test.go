@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// fakeLogs answers every log query with filter
+type fakeLogs func(q ethereum.FilterQuery) ([]types.Log, error)
+
+func (f fakeLogs) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return f(q)
+}
+
+// failingSink fails every write, like a full disk
+type failingSink struct{}
+
+func (failingSink) Write(t Transfer) error { return errors.New("no space left on device") }
+func (failingSink) Close() error           { return nil }
+
+func TestFailureCode(t *testing.T) {
+	failingNode := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+		return nil, errors.New("connection reset by peer")
+	})
+	_, scanErr := getUSDCTransfers(context.Background(), failingNode, scanConfig{StartBlock: 1, EndBlock: 10, ChunkSize: 5}, &collectSink{})
+
+	logs := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+		return []types.Log{testLog(transferTopic, testAlice, testBob, 1, q.FromBlock.Uint64(), 0)}, nil
+	})
+	_, sinkErr := getUSDCTransfers(context.Background(), logs, scanConfig{StartBlock: 1, EndBlock: 10, ChunkSize: 5}, failingSink{})
+
+	for _, tt := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"fetchChunk failure", scanErr, EXIT_RPC},
+		{"sink failure", sinkErr, EXIT_FAILURE},
+		{"full disk", fmt.Errorf("Failed to write transfer: %w", &fs.PathError{Op: "write", Path: "/dev/full", Err: syscall.ENOSPC}), EXIT_FAILURE},
+		{"HTTP error status", fmt.Errorf("call: %w", rpc.HTTPError{StatusCode: 503}), EXIT_RPC},
+		{"timeout", context.DeadlineExceeded, EXIT_RPC},
+		{"no code", fmt.Errorf("Failed to detect the deployment block: %w", ErrNoCode), EXIT_BAD_INPUT},
+		{"bad input", badInput(errors.New("Invalid argument 1")), EXIT_BAD_INPUT},
+		{"handler error", fmt.Errorf("Failed to write transfer: %w", errors.New("handler failed")), EXIT_FAILURE},
+	} {
+		if got := failureCode(context.Background(), tt.err); got != tt.want {
+			t.Errorf("%s: failureCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+	if !errors.Is(scanErr, errRPC) {
+		t.Errorf("scan error %v isn't marked as an RPC error", scanErr)
+	}
+	if scanErr.Error() != "Failed to filter logs in blocks 1-5: connection reset by peer" {
+		t.Errorf("marking changed the message to %q", scanErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := failureCode(ctx, scanErr); got != EXIT_INTERRUPTED {
+		t.Errorf("failureCode after cancellation = %d, want %d", got, EXIT_INTERRUPTED)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// How often -since-deployment logs its progress
+const EXPORT_PROGRESS_INTERVAL = 10 * time.Second
+
+// exportWriter writes the ndjson records of -since-deployment to a gzip file.
+// Checkpoint ends the current gzip member and syncs the file, so the offset
+// saved in the state file always marks the end of complete members. A resumed
+// export truncates whatever an interrupted run wrote after that offset and
+// appends new members, which readers decompress as one stream.
+type exportWriter struct {
+	path    string
+	file    *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	opts    outputOptions
+	records uint64
+	dirty   bool // written since the last checkpoint
+
+	end        uint64
+	reportedAt time.Time
+}
+
+// openExport opens the export at path, truncated to the checkpoint of state.
+// A new export refuses to overwrite an existing non-empty file.
+func openExport(path string, state *scanState, end uint64, opts outputOptions) (*exportWriter, error) {
+	if state.Checkpoint != nil && state.ExportOffset == nil {
+		return nil, fmt.Errorf("State file has a checkpoint but no export offset, it didn't come from -since-deployment")
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create output file: %v", err)
+	}
+	var offset int64
+	if state.ExportOffset != nil {
+		offset = *state.ExportOffset
+	}
+	info, err := file.Stat()
+	if err == nil && state.ExportOffset == nil && info.Size() > 0 {
+		file.Close()
+		return nil, fmt.Errorf("%s already has %d bytes but the state file has no export offset; remove it or pass the -state of the export that wrote it", path, info.Size())
+	}
+	if err == nil && info.Size() < offset {
+		err = fmt.Errorf("%s has %d bytes, fewer than the %d of the checkpoint", path, info.Size(), offset)
+	}
+	if err == nil {
+		err = file.Truncate(offset)
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Failed to resume the export: %v", err)
+	}
+	if offset > 0 {
+		log.Printf("Resuming the export of %s after %d records", path, state.Exported)
+	}
+
+	gz, err := gzip.NewWriterLevel(file, gzipLevel)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &exportWriter{
+		path:       path,
+		file:       file,
+		gz:         gz,
+		buf:        bufio.NewWriter(gz),
+		opts:       opts,
+		records:    state.Exported,
+		end:        end,
+		reportedAt: time.Now(),
+	}, nil
+}
+
+func (e *exportWriter) Write(t Transfer) error {
+	data, err := encodeTransfer(FORMAT_NDJSON, t, e.opts)
+	if err != nil {
+		return err
+	}
+	if _, err := e.buf.Write(data); err != nil {
+		return fmt.Errorf("Failed to write %s: %v", e.path, err)
+	}
+	e.records++
+	e.dirty = true
+	return nil
+}
+
+// flush ends the current gzip member and returns the offset after it
+func (e *exportWriter) flush() (int64, error) {
+	if e.dirty {
+		if err := e.buf.Flush(); err != nil {
+			return 0, err
+		}
+		if err := e.gz.Close(); err != nil {
+			return 0, err
+		}
+		if err := e.file.Sync(); err != nil {
+			return 0, err
+		}
+		e.gz.Reset(e.file)
+		e.dirty = false
+	}
+	return e.file.Seek(0, io.SeekCurrent)
+}
+
+// Checkpoint makes everything written so far durable and records it in
+// state, before fullScan saves its checkpoint
+func (e *exportWriter) Checkpoint(state *scanState) error {
+	offset, err := e.flush()
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %v", e.path, err)
+	}
+	state.ExportOffset = &offset
+	state.Exported = e.records
+
+	if state.Checkpoint != nil && state.DeploymentBlock != nil && time.Since(e.reportedAt) >= EXPORT_PROGRESS_INTERVAL {
+		done := *state.Checkpoint - *state.DeploymentBlock + 1
+		total := e.end - *state.DeploymentBlock + 1
+		log.Printf("Exported %d records through block %d of %d (%.1f%%), %d bytes", e.records, *state.Checkpoint, e.end, 100*float64(done)/float64(total), offset)
+		e.reportedAt = time.Now()
+	}
+	return nil
+}
+
+// Close ends the last gzip member. Records written after the last
+// checkpoint stay in the file but are truncated by a resumed export.
+func (e *exportWriter) Close() error {
+	_, err := e.flush()
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenExportKeepsExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usdc.ndjson.gz")
+	if err := os.WriteFile(path, []byte("earlier export"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openExport(path, &scanState{}, 100, outputOptions{}); err == nil {
+		t.Fatal("a new export overwrote an existing file")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "earlier export" {
+		t.Errorf("the existing file now has %q", data)
+	}
+
+	// An empty file holds nothing to lose
+	empty := filepath.Join(t.TempDir(), "empty.ndjson.gz")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	export, err := openExport(empty, &scanState{}, 100, outputOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := export.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
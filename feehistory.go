@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Most nodes serve at most 1024 blocks per eth_feeHistory call
+const FEE_HISTORY_MAX_BLOCKS = 1024
+
+// baseFees returns the base fee of every block in [start, end], in wei
+func baseFees(ctx context.Context, client *ethclient.Client, start uint64, end uint64) (map[uint64]*big.Int, error) {
+	fees := make(map[uint64]*big.Int, end-start+1)
+	err := forEachChunk(start, end, FEE_HISTORY_MAX_BLOCKS, func(from uint64, to uint64) error {
+		history, err := client.FeeHistory(ctx, to-from+1, new(big.Int).SetUint64(to), nil)
+		if err != nil {
+			return rpcFailure(fmt.Errorf("Failed to get the fee history of blocks %d-%d: %v", from, to, err))
+		}
+		// BaseFee has one extra entry, the base fee of the block after the range
+		oldest := history.OldestBlock.Uint64()
+		for i, fee := range history.BaseFee {
+			if n := oldest + uint64(i); n <= to {
+				fees[n] = fee
+			}
+		}
+		return nil
+	})
+	return fees, err
+}
+
+// feeHistory scans the range and writes one {from_block, to_block, count,
+// volume, avg_base_fee_gwei} row per bucket of blocks, to correlate transfer
+// activity with congestion. Blocks before London have no base fee and are
+// left out of the average.
+func feeHistory(ctx context.Context, client *ethclient.Client, logs logFilterer, cfg scanConfig, bucket uint64, opts outputOptions, w io.Writer, format string) error {
+	totals := newBlockTotals()
+	if _, err := getUSDCTransfers(ctx, logs, cfg, totals); err != nil {
+		return err
+	}
+	fees, err := baseFees(ctx, client, cfg.StartBlock, cfg.EndBlock)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]interface{}
+	forEachChunk(cfg.StartBlock, cfg.EndBlock, bucket, func(from uint64, to uint64) error {
+		count, volume := 0, new(big.Int)
+		feeSum, feeBlocks := new(big.Int), int64(0)
+		for n := from; n <= to; n++ {
+			if total, ok := totals.blocks[n]; ok {
+				count += total.Count
+				volume.Add(volume, total.Volume)
+			}
+			if fee, ok := fees[n]; ok && fee.Sign() > 0 {
+				feeSum.Add(feeSum, fee)
+				feeBlocks++
+			}
+		}
+		avgFee := ""
+		if feeBlocks > 0 {
+			avg := new(big.Rat).SetFrac(feeSum, big.NewInt(feeBlocks*params.GWei))
+			avgFee = avg.FloatString(3)
+		}
+		rows = append(rows, []interface{}{from, to, count, opts.reportAmount(format, volume), avgFee})
+		return nil
+	})
+	return writeTable(w, format, []string{"from_block", "to_block", "count", "volume", "avg_base_fee_gwei"}, rows)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// transferFilter is a client-side predicate on decoded records; the summary
+// counts the records each filter dropped by its name. Keep only fails for
+// filters that look up more data, which aborts the scan.
+type transferFilter struct {
+	Name string
+	Keep func(t Transfer) (bool, error)
+}
+
+// excludeAddresses drops records sent from or to any of addresses. eth_getLogs
+// can't express exclusion, so this is a client-side post-filter: the excluded
+// logs are still downloaded.
+func excludeAddresses(addresses []common.Address) transferFilter {
+	excluded := make(map[common.Address]struct{}, len(addresses))
+	for _, address := range addresses {
+		excluded[address] = struct{}{}
+	}
+	return transferFilter{Name: "-exclude-addr", Keep: func(t Transfer) (bool, error) {
+		_, from := excluded[t.From]
+		_, to := excluded[t.To]
+		return !from && !to, nil
+	}}
+}
+
+// isSelfTransfer reports whether t is a Transfer from an address to itself
+func isSelfTransfer(t Transfer) bool {
+	return t.Event == EventTransfer && t.From == t.To
+}
+
+// excludeSelf drops self-transfers
+var excludeSelf = transferFilter{Name: "-exclude-self", Keep: func(t Transfer) (bool, error) {
+	return !isSelfTransfer(t), nil
+}}
+
+// parseAddressList parses comma separated addresses from repeated flag values
+func parseAddressList(values []string) ([]common.Address, error) {
+	var addresses []common.Address
+	for _, value := range values {
+		for _, s := range strings.Split(value, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if !common.IsHexAddress(s) {
+				return nil, fmt.Errorf("Invalid address %q", s)
+			}
+			addresses = append(addresses, common.HexToAddress(s))
+		}
+	}
+	return addresses, nil
+}
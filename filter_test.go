@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestExcludeSelf(t *testing.T) {
+	logs := []types.Log{
+		testLog(transferTopic, testAlice, testAlice, 1_000_000, 10, 0),
+		testLog(transferTopic, testAlice, testBob, 2_000_000, 10, 1),
+		// An approval of oneself isn't a self-transfer
+		testLog(approvalTopic, testBob, testBob, 3_000_000, 11, 0),
+	}
+
+	var records collectSink
+	summary := NewSummary()
+	if err := processLogs(logs, scanConfig{}, &records, summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || summary.SelfTransfers != 1 {
+		t.Errorf("without -exclude-self got %d records and %d self-transfers, want 3 and 1", len(records), summary.SelfTransfers)
+	}
+
+	records = nil
+	summary = NewSummary()
+	if err := processLogs(logs, scanConfig{Filters: []transferFilter{excludeSelf}}, &records, summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].To != testBob || records[1].Event != EventApproval {
+		t.Errorf("with -exclude-self got %+v, want the transfer to bob and the approval", records)
+	}
+	if summary.SelfTransfers != 0 || summary.Filtered[excludeSelf.Name] != 1 {
+		t.Errorf("with -exclude-self counted %d self-transfers and %d excluded, want 0 and 1", summary.SelfTransfers, summary.Filtered[excludeSelf.Name])
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// blockRange is an inclusive range of blocks
+type blockRange struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// scanState is the state file of a -full scan. Checkpoint is the last block of
+// the last chunk scanned; chunks that failed are recorded as gaps and retried
+// by the next run. ExportOffset is the size of the -since-deployment file at
+// the checkpoint, holding Exported records.
+type scanState struct {
+	Token           string       `json:"token"`
+	DeploymentBlock *uint64      `json:"deployment_block,omitempty"`
+	Checkpoint      *uint64      `json:"checkpoint,omitempty"`
+	Gaps            []blockRange `json:"gaps,omitempty"`
+	ExportOffset    *int64       `json:"export_offset,omitempty"`
+	Exported        uint64       `json:"exported,omitempty"`
+}
+
+// loadScanState reads the state file at path; a missing file is a new scan of token
+func loadScanState(path string, token common.Address) (*scanState, error) {
+	state := &scanState{Token: token.Hex()}
+	if path == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("Failed to decode state file %s: %v", path, err)
+	}
+	if common.HexToAddress(state.Token) != token {
+		return nil, fmt.Errorf("State file %s belongs to token %s", path, state.Token)
+	}
+	return state, nil
+}
+
+// save writes the state to path atomically, so an interrupted run never leaves a torn file
+func (s *scanState) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fullScan scans the token from its deployment block to cfg.EndBlock. The
+// deployment block is detected once and cached in the state file at
+// statePath, which is updated after every chunk so a later run resumes after
+// the checkpoint. A chunk that still fails after the pool's failover is
+// recorded as a gap and skipped, and the gaps of earlier runs are retried first.
+// If set, checkpoint is called before every save of a scanned chunk, so the
+// outputs can record how far they got in the state.
+func fullScan(ctx context.Context, client *ethclient.Client, logs logFilterer, cfg scanConfig, state *scanState, statePath string, sink Sink, checkpoint func(state *scanState) error) (*Summary, error) {
+	if state.DeploymentBlock == nil {
+		block, err := deploymentBlockAt(ctx, client, cfg.Token, cfg.EndBlock)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to detect the deployment block: %w", err)
+		}
+		log.Printf("%s was deployed in block %d", cfg.Token.Hex(), block)
+		state.DeploymentBlock = &block
+		if err := state.save(statePath); err != nil {
+			return nil, err
+		}
+	}
+	start := *state.DeploymentBlock
+	if state.Checkpoint != nil {
+		start = *state.Checkpoint + 1
+	}
+
+	query := cfg.filterQuery()
+	summary := NewRunningSummary()
+	retry := state.Gaps
+	var failed []blockRange // chunks of this run recorded as gaps
+	// gapsLeft is what state.Gaps must hold once range i is scanned up to
+	// next: the new gaps and every retried gap not yet rescanned, so a killed
+	// run never loses one
+	gapsLeft := func(i int, next uint64) []blockRange {
+		gaps := append([]blockRange(nil), failed...)
+		if i < len(retry) {
+			if next <= retry[i].To {
+				gaps = append(gaps, blockRange{next, retry[i].To})
+			}
+			gaps = append(gaps, retry[i+1:]...)
+		}
+		return gaps
+	}
+	ranges := append(append([]blockRange(nil), retry...), blockRange{start, cfg.EndBlock})
+	for i, r := range ranges {
+		resumed := i < len(retry)
+		next := r.From
+		err := forEachChunk(r.From, r.To, cfg.ChunkSize, func(from uint64, to uint64) error {
+			chunk, err := fetchChunk(ctx, logs, query, from, to, cfg.RetryOnEmpty)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			scanned := failed
+			if err != nil {
+				log.Printf("WARNING: skipping blocks %d-%d, recorded as a gap: %v", from, to, err)
+				failed = append(failed, blockRange{from, to})
+			} else if err := processLogs(chunk, cfg, sink, summary); err != nil {
+				return err
+			}
+			// A failed checkpoint leaves the chunk to be scanned again
+			if err := syncSinks(sink); err != nil {
+				failed = scanned
+				return fmt.Errorf("Failed to sync the outputs: %w", err)
+			}
+			prev, prevGaps := state.Checkpoint, state.Gaps
+			if !resumed {
+				state.Checkpoint = &to
+			}
+			state.Gaps = gapsLeft(i, to+1)
+			if checkpoint != nil {
+				if err := checkpoint(state); err != nil {
+					state.Checkpoint, state.Gaps, failed = prev, prevGaps, scanned
+					return err
+				}
+			}
+			next = to + 1
+			return state.save(statePath)
+		})
+		if err != nil {
+			state.Gaps = gapsLeft(i, next)
+			if saveErr := state.save(statePath); saveErr != nil {
+				log.Printf("Failed to save the state file: %v", saveErr)
+			}
+			return nil, err
+		}
+	}
+
+	fmt.Fprintf(infoOut, "Scanned blocks %d to %d with %d gaps\n", *state.DeploymentBlock, cfg.EndBlock, len(state.Gaps))
+	summary.Finish()
+	return summary, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestFullScanKeepsUnretriedGaps(t *testing.T) {
+	token := common.HexToAddress(USDC_CONTRACT_ADDRESS)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	deployed, checkpoint := uint64(0), uint64(99)
+	state := &scanState{
+		Token:           token.Hex(),
+		DeploymentBlock: &deployed,
+		Checkpoint:      &checkpoint,
+		Gaps:            []blockRange{{10, 19}, {30, 39}, {50, 59}},
+	}
+	if err := state.save(statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// What a run killed while retrying the second gap would leave behind
+	var partway []blockRange
+	node := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+		if q.FromBlock.Uint64() == 30 {
+			saved, err := loadScanState(statePath, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			partway = saved.Gaps
+		}
+		if q.FromBlock.Uint64() == 50 {
+			return nil, errors.New("still failing")
+		}
+		return nil, nil
+	})
+	cfg := scanConfig{Token: token, EndBlock: 99, ChunkSize: 10}
+	if _, err := fullScan(context.Background(), nil, node, cfg, state, statePath, &collectSink{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []blockRange{{30, 39}, {50, 59}}; !slices.Equal(partway, want) {
+		t.Errorf("state while retrying the second gap has gaps %v, want %v", partway, want)
+	}
+	saved, err := loadScanState(statePath, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []blockRange{{50, 59}}; !slices.Equal(saved.Gaps, want) {
+		t.Errorf("final state has gaps %v, want the one that still fails %v", saved.Gaps, want)
+	}
+}
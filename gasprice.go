@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// txReader is implemented by *ethclient.Client
+type txReader interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+}
+
+// gasPriceCache looks up the gas price paid by transactions, once per hash
+type gasPriceCache struct {
+	client txReader
+
+	mu     sync.Mutex
+	prices map[common.Hash]*big.Int
+}
+
+func newGasPriceCache(client txReader) *gasPriceCache {
+	return &gasPriceCache{client: client, prices: make(map[common.Hash]*big.Int)}
+}
+
+// GasPrice returns the effective gas price of the receipt, which for EIP-1559
+// transactions is the base fee plus the tip actually paid. Nodes that predate
+// the receipt field fall back to the transaction's gas price.
+func (c *gasPriceCache) GasPrice(ctx context.Context, hash common.Hash) (*big.Int, error) {
+	c.mu.Lock()
+	price, ok := c.prices[hash]
+	c.mu.Unlock()
+	if ok {
+		return price, nil
+	}
+
+	receipt, err := c.client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	price = receipt.EffectiveGasPrice
+	if price == nil {
+		tx, _, err := c.client.TransactionByHash(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		price = tx.GasPrice()
+	}
+
+	c.mu.Lock()
+	c.prices[hash] = price
+	c.mu.Unlock()
+	return price, nil
+}
+
+// minGasPrice drops records of transactions that paid less than min wei per gas
+func minGasPrice(ctx context.Context, cache *gasPriceCache, min *big.Int) transferFilter {
+	return transferFilter{Name: "-min-gas-price", Keep: func(t Transfer) (bool, error) {
+		price, err := cache.GasPrice(ctx, t.TxHash)
+		if err != nil {
+			return false, err
+		}
+		return price.Cmp(min) >= 0, nil
+	}}
+}
+
+// maxGasPrice drops records of transactions that paid more than max wei per gas
+func maxGasPrice(ctx context.Context, cache *gasPriceCache, max *big.Int) transferFilter {
+	return transferFilter{Name: "-max-gas-price", Keep: func(t Transfer) (bool, error) {
+		price, err := cache.GasPrice(ctx, t.TxHash)
+		if err != nil {
+			return false, err
+		}
+		return price.Cmp(max) <= 0, nil
+	}}
+}
+
+// parseGwei parses a decimal gwei amount such as "1.5" into wei
+func parseGwei(s string) (*big.Int, error) {
+	amount, ok := new(big.Rat).SetString(s)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("Invalid gwei amount %q", s)
+	}
+	amount.Mul(amount, new(big.Rat).SetInt64(params.GWei))
+	if !amount.IsInt() {
+		return nil, fmt.Errorf("Gwei amount %q has more than 9 decimals", s)
+	}
+	return amount.Num(), nil
+}
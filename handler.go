@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// TransferHandler is a custom processing step for decoded records, e.g.
+// enrichment, filtering or routing. Handlers are registered with
+// RegisterHandler from an init function in an extra file of this package.
+//
+// For each record the registered handlers run one after another in
+// registration order, on the scanning goroutine, before the output sinks.
+// A handler returning ErrSkipTransfer drops the record: the later handlers
+// and the sinks don't see it and the summary counts it as excluded. Any other
+// error stops the scan.
+type TransferHandler interface {
+	Handle(ctx context.Context, t Transfer) error
+}
+
+// HandlerFunc adapts a function to a TransferHandler
+type HandlerFunc func(ctx context.Context, t Transfer) error
+
+func (f HandlerFunc) Handle(ctx context.Context, t Transfer) error {
+	return f(ctx, t)
+}
+
+// ErrSkipTransfer is returned by a handler to drop a record without failing
+var ErrSkipTransfer = errors.New("transfer skipped by a handler")
+
+// Summary key of the records dropped by handlers
+const HANDLER_FILTER_NAME = "handlers"
+
+var registeredHandlers []TransferHandler
+
+// RegisterHandler appends h to the handlers run for every record of a scan
+func RegisterHandler(h TransferHandler) {
+	registeredHandlers = append(registeredHandlers, h)
+}
+
+// sinkHandler runs a Sink as the last step of a pipeline
+type sinkHandler struct {
+	sink Sink
+}
+
+func (s sinkHandler) Handle(ctx context.Context, t Transfer) error {
+	return s.sink.Write(t)
+}
+
+func (s sinkHandler) Close() error {
+	return s.sink.Close()
+}
+
+// pipeline is a sink passing each record through a list of handlers.
+// Handlers that are also io.Closers are closed with it.
+type pipeline struct {
+	ctx      context.Context
+	handlers []TransferHandler
+}
+
+// withHandlers runs the registered handlers in front of sink
+func withHandlers(ctx context.Context, sink Sink) Sink {
+	if len(registeredHandlers) == 0 {
+		return sink
+	}
+	handlers := append(append([]TransferHandler(nil), registeredHandlers...), sinkHandler{sink})
+	return &pipeline{ctx: ctx, handlers: handlers}
+}
+
+func (p *pipeline) Write(t Transfer) error {
+	for _, h := range p.handlers {
+		if err := h.Handle(p.ctx, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pipeline) Close() error {
+	var errs []error
+	for _, h := range p.handlers {
+		if closer, ok := h.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,110 +1,821 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 // USDC contract address
 const USDC_CONTRACT_ADDRESS = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
 
+// Decimals assumed when the decimals() call fails
+const USDC_DEFAULT_DECIMALS = 6
+
 // Transfer event signature
 const TRANSFER_EVENT_SIGNATURE = "Transfer(address,address,uint256)"
 
 // USDC interface
 type USDC interface {
 	Decimals(opts *bind.CallOpts) (uint8, error)
+	DecimalsCtx(ctx context.Context) (uint8, error)
+	DecimalsOrDefault(ctx context.Context, timeout time.Duration, fallback uint8) uint8
+	Name(opts *bind.CallOpts) (string, error)
+	NameCtx(ctx context.Context) (string, error)
+	Symbol(opts *bind.CallOpts) (string, error)
+	SymbolCtx(ctx context.Context) (string, error)
+	Admin(opts *bind.CallOpts) (common.Address, error)
+	AdminCtx(ctx context.Context) (common.Address, error)
+	TotalSupply(opts *bind.CallOpts) (*big.Int, error)
+	TotalSupplyCtx(ctx context.Context) (*big.Int, error)
 }
 
+var (
+	infoMode = flag.Bool("info", false, "Print USDC proxy info (decimals, admin) and exit")
+	verbose  = flag.Bool("v", false, "Verbose output")
+	otelFlag = flag.Bool("otel", false, "Export OpenTelemetry traces over OTLP/HTTP, configured with the OTEL_EXPORTER_OTLP_* environment variables")
+	rpcURLs  = flag.String("rpc", "https://eth.llamarpc.com", "Comma separated RPC endpoints; log queries prefer the fastest healthy one and fail over to the others")
+
+	parallel  = flag.Bool("parallel", false, "Fetch chunks concurrently from all -rpc endpoints, reassigning the chunks of failing ones")
+	rateLimit = flag.Float64("rate-limit", 0, "Maximum log queries per second per -rpc endpoint (default: unlimited)")
+
+	tokenListSource = flag.String("token-list", "", "Load token definitions from a Uniswap-style tokenlist.json URL or file for -token")
+	tokenFlag       = flag.String("token", "", "Token to query, as an address or a symbol of the built-in or -token-list registry on the connected chain (default: USDC)")
+	tokensFlag      = flag.String("tokens", "", "Scan these comma separated tokens (addresses or symbols) concurrently instead of -token, each into its own -format file in -out-dir named by symbol or address")
+	metadataMode    = flag.Bool("metadata", false, "Print the registry entry of -token (name, symbol, decimals, logoURI, chainId) and exit; unlisted tokens are read on-chain")
+
+	noMetadata      = flag.Bool("no-metadata", false, "Skip the decimals(), symbol() and chain ID calls: amounts are raw integers (unless -decimals) and the token is labelled by its address")
+	decimalsFlag    = flag.Int("decimals", -1, "Token decimals; skips the decimals() call (default: read from the contract)")
+	metadataTimeout = flag.Duration("metadata-timeout", 10*time.Second, "Timeout of the decimals() call before falling back to the default")
+
+	precision    = flag.Int("precision", -1, "Round displayed text/csv amounts to this many fractional digits (default: all token decimals)")
+	unit         = flag.String("unit", UNIT_BASE, "Scale text amounts: base, k, m or b for thousands, millions or billions with a suffix, e.g. 1.50M (csv and ndjson stay unscaled)")
+	csvPrecision = flag.Int("csv-precision", -1, "Write the csv amount_usdc column with exactly this many fractional digits, independently from -precision (amount_raw stays exact)")
+
+	format        = flag.String("format", FORMAT_TEXT, "Output format: text, csv or ndjson")
+	outPath       = flag.String("out", "", "Write transfers to this file instead of stdout")
+	outDir        = flag.String("out-dir", ".", "Directory of the per-token output files of -tokens")
+	rotateSize    = flag.Int64("rotate-size", 0, "Start a new numbered output file once the current one exceeds this many uncompressed bytes")
+	gzipLevelFlag = flag.Int("gzip-level", gzip.DefaultCompression, "Compression level 1 (fastest) to 9 (smallest) of output files named *.gz")
+	sinkFlags     stringList
+	sinkBuffer    = flag.Int("sink-buffer", 0, "Buffer up to this many records per sink and write each sink from its own goroutine, so a slow sink doesn't stall the scan (default: write synchronously)")
+	sinkOverflow  = flag.String("sink-overflow", OVERFLOW_BLOCK, "What a full -sink-buffer does with a new record: block, drop-oldest or drop-newest")
+
+	callSig  = flag.String("call", "", "Call a read-only ABI method, e.g. \"balanceOf(address)\", print the result and exit")
+	callArgs = flag.String("args", "", "Comma separated arguments for -call")
+
+	withApprovals = flag.Bool("approvals", false, "Also query Approval events, in the same eth_getLogs call")
+	traceFlag     = flag.Bool("with-trace", false, "Print the call context of each transfer's tx from debug_traceTransaction (callTracer); needs a provider with the debug namespace, one call per tx")
+
+	fromBlock    = flag.Int64("from", -1, "First block to scan (default: 99 blocks before -to)")
+	toBlock      = flag.Int64("to", -1, "Last block to scan (default: latest block)")
+	chunkSize    = flag.Uint64("chunk-size", 500, "Maximum number of blocks per eth_getLogs call")
+	reverse      = flag.Bool("reverse", false, "Scan the chunks from -to downwards and print the newest transfers first")
+	maxResults   = flag.Int("max-results", 0, "Stop the scan after this many records, e.g. the last N transfers with -reverse (default: no limit)")
+	retryOnEmpty = flag.Int("retry-on-empty", 0, "Retry chunks that return no logs up to this many times, for providers that intermittently return empty results")
+
+	supplyHistoryMode = flag.Bool("supply-history", false, "Write {block, supply} rows sampling totalSupply() every -interval blocks (requires an archive node)")
+	supplyInterval    = flag.Uint64("interval", 7200, "Blocks between -supply-history samples (7200 is about a day)")
+
+	snapshotMode  = flag.Bool("snapshot", false, "Write {address, balance} rows at block -to, largest first")
+	addressesFile = flag.String("addresses", "", "File with one address per line for -snapshot (default: every address in a transfer scan of -from..-to)")
+	concurrency   = flag.Int("concurrency", 4, "Maximum concurrent multicall requests")
+	batchSize     = flag.Int("multicall-batch", MULTICALL_BATCH_SIZE, "balanceOf calls packed into one Multicall3 call; a rejected batch is halved and retried")
+	snapshotPct   = flag.Bool("pct", false, "Add a -snapshot pct column of each balance as a percentage of totalSupply() at the snapshot block")
+
+	sumByDayMode = flag.Bool("sum-by-day", false, "Write {date, count, volume} rows per UTC day instead of individual transfers")
+
+	discoverMode = flag.Bool("discover-events", false, "Write {topic, event, count} rows of every first topic the token's logs have in the range, named from the ABI where known")
+	activityMode = flag.Bool("activity-report", false, "Write {address, volume} rows of the volume each address sent and received, most active first")
+
+	feeHistoryMode = flag.Bool("fee-history", false, "Write {from_block, to_block, count, volume, avg_base_fee_gwei} rows per -bucket blocks, from extra eth_feeHistory calls")
+	feeBucket      = flag.Uint64("bucket", 100, "Blocks per -fee-history row")
+
+	fullMode  = flag.Bool("full", false, "Scan from the token's deployment block, detected with CodeAt (requires an archive node), to -to or the latest block")
+	statePath = flag.String("state", "", "State file of -full with the deployment block, checkpoint and gaps; an existing one resumes the scan and appends to the outputs")
+	exportTo  = flag.String("since-deployment", "", "Export the token's whole history as -full to this *.ndjson.gz file, checkpointed in -state (default: the file name plus .state) so an interrupted export resumes")
+
+	estimateMode = flag.Bool("estimate", false, "Estimate the number of transfers in the range from a few sampled chunks and exit, before committing to a full scan")
+
+	canonicalJSON = flag.Bool("canonical-json", false, "Write ndjson records with sorted keys and fixed formatting, byte-identical across runs")
+
+	checksumFlag = flag.Bool("checksum", false, "Print a keccak256 checksum of the sorted, canonicalized records at the end, to compare runs across providers")
+
+	excludeAddrFlags stringList
+	excludeSelfFlag  = flag.Bool("exclude-self", false, "Drop transfers from an address to itself")
+	minGasPriceFlag  = flag.String("min-gas-price", "", "Drop transfers of transactions that paid less than this many gwei per gas; costs one eth_getTransactionReceipt call per transaction")
+	maxGasPriceFlag  = flag.String("max-gas-price", "", "Drop transfers of transactions that paid more than this many gwei per gas; costs one eth_getTransactionReceipt call per transaction")
+
+	skipDecodeErrors = flag.Bool("skip-decode-errors", true, "Skip logs that fail to decode with a warning; set to false to abort instead")
+	strictTopics     = flag.Bool("strict-topics", false, "Abort on logs that don't have exactly the 3 topics of a standard Transfer or Approval, instead of skipping them")
+
+	replayPath  = flag.String("replay", "", "Decode raw logs saved with -save-raw-logs instead of querying the node")
+	rawLogsPath = flag.String("save-raw-logs", "", "Also save the raw logs of the scan as a json array to this file")
+
+	watch        = flag.Bool("watch", false, "Keep polling for new blocks after the initial scan, until interrupted")
+	pollInterval = flag.Duration("poll", 12*time.Second, "Watch mode polling interval")
+	pollAdaptive = flag.Bool("poll-adaptive", false, "Adapt the watch polling interval to the observed block time, starting from -poll")
+	pollMin      = flag.Duration("poll-min", time.Second, "Shortest -poll-adaptive interval")
+	pollMax      = flag.Duration("poll-max", time.Minute, "Longest -poll-adaptive interval, reached while no new blocks arrive")
+	reorgDepth   = flag.Uint64("reorg-depth", 5, "Blocks re-scanned on every watch poll to pick up reorged logs")
+	headLag      = flag.Duration("head-lag", time.Minute, "How often watch mode logs how far it is behind the chain head (0 disables)")
+	metricsAddr  = flag.String("metrics", "", "Serve expvar metrics such as head_lag_blocks and head_lag_seconds on this address at /debug/vars")
+	dedupeWindow = flag.Uint64("dedupe-window", 0, "Only remember watch mode dedup keys for this many recent blocks (default: remember all)")
+
+	serveAddr     = flag.String("serve", "", "Serve a REST API on this address, e.g. :8080, with GET /transfers?from=&to=&min_confirmations=")
+	serveMaxRange = flag.Uint64("serve-max-range", 10000, "Maximum number of blocks per REST API request")
+	serveCache    = flag.Bool("serve-cache", false, "Cache the logs of scanned block ranges older than -reorg-depth in memory and only query the node for uncached ones, see GET /cache")
+	readTimeout   = flag.Duration("read-timeout", 10*time.Second, "Maximum time for the REST API to read a request")
+	writeTimeout  = flag.Duration("write-timeout", time.Minute, "Maximum time for the REST API to write a response, scan included (event streams are exempt)")
+	idleTimeout   = flag.Duration("idle-timeout", 2*time.Minute, "How long the REST API keeps idle keep-alive connections open")
+	drainTimeout  = flag.Duration("shutdown-timeout", 10*time.Second, "How long in-flight REST API requests may finish on SIGINT/SIGTERM")
+)
+
+// Informational output; moved to stderr when stdout carries csv/ndjson data
+var infoOut io.Writer = os.Stdout
+
 func main() {
-	// Connect to the Ethereum mainnet
-	client, err := ethclient.Dial("https://eth.llamarpc.com")
-	if err != nil {
-		log.Fatalf("Failed to connect to the Ethereum mainnet: %v", err)
+	flag.Var(&sinkFlags, "sink", "Output sink as format[:path], e.g. csv:transfers.csv; can be repeated to write several outputs in one scan (default: -format and -out)")
+	flag.Var(&excludeAddrFlags, "exclude-addr", "Drop transfers from or to these comma separated addresses, e.g. exchange hot wallets; can be repeated. Filtered client-side, the logs are still downloaded")
+	flag.Parse()
+	// "decode" takes the same flags after it as before it
+	decodeMode := flag.Arg(0) == "decode"
+	if decodeMode {
+		flag.CommandLine.Parse(flag.Args()[1:])
 	}
 
-	// Get the USDC contract instance
-	usdcAddress := common.HexToAddress(USDC_CONTRACT_ADDRESS)
-	usdc, err := NewUSDC(usdcAddress, client)
-	if err != nil {
-		log.Fatalf("Failed to create USDC contract instance: %v", err)
+	if err := verifyUSDCAddress(); err != nil {
+		fatalf(EXIT_FAILURE, "%v", err)
+	}
+	for _, warning := range verifyEventTopics() {
+		log.Printf("WARNING: %s", warning)
+	}
+
+	if !validFormat(*format) {
+		fatalf(EXIT_BAD_INPUT, "Unknown output format %q", *format)
 	}
+	if looksLikeAddress(*tokenFlag) {
+		if err := validateAddress(*tokenFlag); err != nil {
+			fatalf(EXIT_BAD_INPUT, "Invalid -token: %v", err)
+		}
+	}
+	var tokenNames []string
+	for _, name := range strings.Split(*tokensFlag, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if looksLikeAddress(name) {
+			if err := validateAddress(name); err != nil {
+				fatalf(EXIT_BAD_INPUT, "Invalid -tokens entry: %v", err)
+			}
+		}
+		tokenNames = append(tokenNames, name)
+	}
+	if len(tokenNames) > 0 && (*tokenFlag != "" || *outPath != "" || len(sinkFlags) > 0 || *watch || *fullMode || *exportTo != "" ||
+		*serveAddr != "" || *replayPath != "" || *rawLogsPath != "" || *checksumFlag || *traceFlag || *metadataMode ||
+		*estimateMode || *snapshotMode || *supplyHistoryMode || *sumByDayMode || *activityMode || *feeHistoryMode || *discoverMode || *infoMode || *callSig != "") {
+		fatalf(EXIT_BAD_INPUT, "-tokens can't be used with -token, -out, -sink, -watch, -full, -since-deployment, -serve, -replay, -save-raw-logs, -checksum, -with-trace, -metadata, "+
+			"-estimate, -snapshot, -supply-history, -sum-by-day, -activity-report, -fee-history, -discover-events, -info or -call")
+	}
+	if !validUnit(*unit) {
+		fatalf(EXIT_BAD_INPUT, "Unknown -unit %q", *unit)
+	}
+	if *decimalsFlag > 255 {
+		fatalf(EXIT_BAD_INPUT, "-decimals must be at most 255")
+	}
+	if *chunkSize == 0 {
+		fatalf(EXIT_BAD_INPUT, "-chunk-size must be positive")
+	}
+	if *gzipLevelFlag != gzip.DefaultCompression && (*gzipLevelFlag < gzip.BestSpeed || *gzipLevelFlag > gzip.BestCompression) {
+		fatalf(EXIT_BAD_INPUT, "-gzip-level must be between %d and %d", gzip.BestSpeed, gzip.BestCompression)
+	}
+	gzipLevel = *gzipLevelFlag
+	if *sinkBuffer < 0 {
+		fatalf(EXIT_BAD_INPUT, "-sink-buffer can't be negative")
+	}
+	if !validOverflowPolicy(*sinkOverflow) {
+		fatalf(EXIT_BAD_INPUT, "Unknown -sink-overflow policy %q", *sinkOverflow)
+	}
+	buffer := bufferConfig{Size: *sinkBuffer, Policy: *sinkOverflow}
 
-	// Get the USDC decimal places
-	decimals, err := usdc.Decimals(&bind.CallOpts{})
+	var filters []transferFilter
+	excluded, err := parseAddressList(excludeAddrFlags)
 	if err != nil {
-		log.Fatalf("Failed to get USDC decimal places: %v", err)
+		fatalf(EXIT_BAD_INPUT, "Invalid -exclude-addr: %v", err)
+	}
+	if len(excluded) > 0 {
+		filters = append(filters, excludeAddresses(excluded))
+	}
+	if *excludeSelfFlag {
+		filters = append(filters, excludeSelf)
+	}
+	var minGas, maxGas *big.Int
+	if *minGasPriceFlag != "" {
+		if minGas, err = parseGwei(*minGasPriceFlag); err != nil {
+			fatalf(EXIT_BAD_INPUT, "Invalid -min-gas-price: %v", err)
+		}
+	}
+	if *maxGasPriceFlag != "" {
+		if maxGas, err = parseGwei(*maxGasPriceFlag); err != nil {
+			fatalf(EXIT_BAD_INPUT, "Invalid -max-gas-price: %v", err)
+		}
+	}
+	if minGas != nil && maxGas != nil && minGas.Cmp(maxGas) > 0 {
+		fatalf(EXIT_BAD_INPUT, "-min-gas-price must be at most -max-gas-price")
 	}
 
-	fmt.Printf("USDC decimal places: %d\n", decimals)
+	if *watch && *toBlock >= 0 {
+		fatalf(EXIT_BAD_INPUT, "-to can't be used with -watch")
+	}
+	if *rateLimit < 0 {
+		fatalf(EXIT_BAD_INPUT, "-rate-limit can't be negative")
+	}
+	if *pollAdaptive && (*pollMin <= 0 || *pollMin > *pollMax) {
+		fatalf(EXIT_BAD_INPUT, "-poll-min must be positive and at most -poll-max")
+	}
+	if *noMetadata && *infoMode {
+		fatalf(EXIT_BAD_INPUT, "-info can't be used with -no-metadata")
+	}
+	if *exportTo != "" {
+		if *outPath != "" || len(sinkFlags) > 0 || *serveAddr != "" || *replayPath != "" {
+			fatalf(EXIT_BAD_INPUT, "-since-deployment can't be used with -out, -sink, -serve or -replay")
+		}
+		if !strings.HasSuffix(*exportTo, ".ndjson.gz") {
+			fatalf(EXIT_BAD_INPUT, "-since-deployment must name a *.ndjson.gz file")
+		}
+		*fullMode = true
+		if *statePath == "" {
+			*statePath = *exportTo + ".state"
+		}
+	}
+	if *rawLogsPath != "" && (*watch || *fullMode || *serveAddr != "") {
+		fatalf(EXIT_BAD_INPUT, "-save-raw-logs can't be used with -watch, -full, -since-deployment or -serve")
+	}
+	if *fullMode && (*fromBlock >= 0 || *watch || *rotateSize > 0) {
+		fatalf(EXIT_BAD_INPUT, "-full can't be used with -from, -watch or -rotate-size")
+	}
+	if *fullMode && *sinkBuffer > 0 {
+		fatalf(EXIT_BAD_INPUT, "-sink-buffer can't be used with -full or -since-deployment, whose checkpoints must cover every record written")
+	}
+	if *maxResults < 0 {
+		fatalf(EXIT_BAD_INPUT, "-max-results can't be negative")
+	}
+	if (*reverse || *maxResults > 0) && (*watch || *fullMode || *serveAddr != "") {
+		fatalf(EXIT_BAD_INPUT, "-reverse and -max-results can't be used with -watch, -full or -serve")
+	}
+	if *reverse && *parallel {
+		fatalf(EXIT_BAD_INPUT, "-reverse can't be used with -parallel")
+	}
+	if *dedupeWindow > 0 && *dedupeWindow <= *reorgDepth {
+		fatalf(EXIT_BAD_INPUT, "-dedupe-window must be larger than -reorg-depth")
+	}
 
-	// Get the latest block number
-	header, err := client.HeaderByNumber(context.Background(), nil)
-	if err != nil {
-		log.Fatalf("Failed to get the latest block number: %v", err)
+	sinkSpecs := []sinkSpec{{Format: *format, Path: *outPath}}
+	if len(sinkFlags) > 0 {
+		sinkSpecs = nil
+		for _, value := range sinkFlags {
+			spec, err := parseSinkSpec(value)
+			if err != nil {
+				fatalf(EXIT_BAD_INPUT, "%v", err)
+			}
+			sinkSpecs = append(sinkSpecs, spec)
+		}
+	}
+	stdoutSinks, fileSinks := 0, 0
+	for _, spec := range sinkSpecs {
+		if spec.Path != "" {
+			fileSinks++
+			continue
+		}
+		stdoutSinks++
+		if spec.Format != FORMAT_TEXT {
+			infoOut = os.Stderr
+		}
+	}
+	if stdoutSinks > 1 {
+		fatalf(EXIT_BAD_INPUT, "Only one sink can write to stdout")
+	}
+	if *rotateSize > 0 && fileSinks == 0 {
+		fatalf(EXIT_BAD_INPUT, "-rotate-size requires an output file")
 	}
-	latestBlock := header.Number.Uint64()
 
-	// Calculate the start block number (last 100 blocks)
-	startBlock := latestBlock - 99
-	if startBlock < 0 {
-		startBlock = 0
+	if decodeMode {
+		decimals := uint8(USDC_DEFAULT_DECIMALS)
+		if *decimalsFlag >= 0 {
+			decimals = uint8(*decimalsFlag)
+		}
+		opts := outputOptions{Decimals: decimals, Precision: *precision, CSVPrecision: *csvPrecision, Symbol: "USDC", CanonicalJSON: *canonicalJSON, Unit: *unit}
+		if err := decodeCommand(flag.Args(), os.Stdin, os.Stdout, *format, opts); err != nil {
+			fatalf(EXIT_BAD_INPUT, "Failed to decode: %v", err)
+		}
+		return
 	}
 
-	// Query USDC transfer records
-	err = getUSDCTransfers(client, startBlock, latestBlock, decimals)
+	// Cancel in-flight requests on Ctrl-C so outputs are still closed cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer runExitHooks()
+
+	if *otelFlag {
+		shutdown, err := setupTracing(ctx)
+		if err != nil {
+			fatalf(EXIT_FAILURE, "Failed to set up OpenTelemetry: %v", err)
+		}
+		atExit(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				log.Printf("Failed to flush traces: %v", err)
+			}
+		})
+	}
+
+	registry := defaultTokens
+	if *tokenListSource != "" {
+		registry, err = loadTokenList(ctx, *tokenListSource)
+		if err != nil {
+			fatalf(EXIT_BAD_INPUT, "Failed to load -token-list: %v", err)
+		}
+	}
+
+	if *replayPath != "" {
+		if minGas != nil || maxGas != nil || *traceFlag {
+			fatalf(EXIT_BAD_INPUT, "-min-gas-price, -max-gas-price and -with-trace need transaction lookups and can't be used with -replay")
+		}
+		replay(*replayPath, sinkSpecs, buffer, filters, registry)
+		return
+	}
+
+	// Connect to the Ethereum mainnet
+	pool, err := newEndpointPool(strings.Split(*rpcURLs, ","), *verbose)
 	if err != nil {
-		log.Fatalf("Failed to query USDC transfer records: %v", err)
+		fatalf(EXIT_BAD_INPUT, "Failed to connect to the Ethereum mainnet: %v", err)
 	}
-}
+	pool.SetRateLimit(*rateLimit)
+	client := pool.Primary()
 
-func getUSDCTransfers(client *ethclient.Client, startBlock uint64, endBlock uint64, decimals uint8) error {
-	usdcAddress := common.HexToAddress(USDC_CONTRACT_ADDRESS)
-	transferSig := []byte(TRANSFER_EVENT_SIGNATURE)
-	transferTopic := crypto.Keccak256Hash(transferSig)
+	if *metadataMode {
+		if err := printTokenMetadata(ctx, os.Stdout, client, registry, *tokenFlag, *metadataTimeout); err != nil {
+			fatalf(failureCode(ctx, err), "Failed to get the -token metadata: %v", err)
+		}
+		return
+	}
 
-	query := ethereum.FilterQuery{
-		FromBlock: big.NewInt(int64(startBlock)),
-		ToBlock:   big.NewInt(int64(endBlock)),
-		Addresses: []common.Address{usdcAddress},
-		Topics:    [][]common.Hash{{transferTopic}},
+	// The gas price filters go last, so only records kept by the others are looked up
+	if minGas != nil || maxGas != nil {
+		gasPrices := newGasPriceCache(client)
+		if minGas != nil {
+			filters = append(filters, minGasPrice(ctx, gasPrices, minGas))
+		}
+		if maxGas != nil {
+			filters = append(filters, maxGasPrice(ctx, gasPrices, maxGas))
+		}
 	}
 
-	logs, err := client.FilterLogs(context.Background(), query)
+	if len(tokenNames) > 0 {
+		startBlock, latestBlock := scanRange(ctx, client)
+		cfg := scanConfig{
+			StartBlock:       startBlock,
+			EndBlock:         latestBlock,
+			ChunkSize:        *chunkSize,
+			WithApprovals:    *withApprovals,
+			RetryOnEmpty:     *retryOnEmpty,
+			SkipDecodeErrors: *skipDecodeErrors,
+			Filters:          filters,
+			Parallel:         *parallel,
+			StrictTopics:     *strictTopics,
+			Reverse:          *reverse,
+			MaxResults:       *maxResults,
+		}
+		opts := outputOptions{Precision: *precision, CSVPrecision: *csvPrecision, CanonicalJSON: *canonicalJSON, Unit: *unit}
+		meta := tokenMetadata{Skip: *noMetadata, Decimals: *decimalsFlag, Timeout: *metadataTimeout}
+		scans := scanTokens(ctx, client, pool, registry, tokenNames, meta, cfg, opts, *format, *outDir, *rotateSize, buffer)
+		failure, records := printTokenScans(infoOut, scans)
+		if failure != nil {
+			exit(failureCode(ctx, failure))
+		}
+		if records == 0 {
+			exit(EXIT_EMPTY)
+		}
+		return
+	}
+
+	var token tokenInfo
+	if *noMetadata && (*tokenFlag == "" || common.IsHexAddress(*tokenFlag)) {
+		// Labelled by address only, so not even the chain ID is needed
+		token.Address = USDC_CONTRACT_ADDRESS
+		if *tokenFlag != "" {
+			token.Address = common.HexToAddress(*tokenFlag).Hex()
+		}
+	} else {
+		token, err = resolveToken(ctx, client, registry, *tokenFlag)
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to resolve -token: %v", err)
+		}
+	}
+	listed := token.Symbol != ""
+
+	// Get the token contract instance
+	tokenAddress := common.HexToAddress(token.Address)
+	usdc, err := NewUSDC(tokenAddress, client)
 	if err != nil {
-		return fmt.Errorf("Failed to filter logs: %v", err)
+		fatalf(EXIT_FAILURE, "Failed to create token contract instance: %v", err)
+	}
+	if *noMetadata {
+		token.Symbol = token.Address
+	} else if token.Symbol == "" {
+		token.Symbol = tokenSymbol(ctx, usdc, tokenAddress, *metadataTimeout)
+	}
+
+	if *callSig != "" {
+		var args []string
+		if *callArgs != "" {
+			args = strings.Split(*callArgs, ",")
+		}
+		err = callMethod(ctx, client, tokenAddress, *callSig, args)
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to call %s: %v", *callSig, err)
+		}
+		return
+	}
+
+	// Get the token decimal places, falling back to the registry's
+	fallbackDecimals := uint8(USDC_DEFAULT_DECIMALS)
+	if listed {
+		fallbackDecimals = token.Decimals
+	}
+	var decimals uint8
+	if *decimalsFlag >= 0 {
+		decimals = uint8(*decimalsFlag)
+	} else if !*noMetadata {
+		decimals = usdc.DecimalsOrDefault(ctx, *metadataTimeout, fallbackDecimals)
+	}
+
+	if !*noMetadata {
+		fmt.Fprintf(infoOut, "%s decimal places: %d\n", token.Symbol, decimals)
+	}
+
+	if *infoMode {
+		err = printProxyInfo(ctx, client, usdc, tokenAddress, *verbose)
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to read USDC proxy info: %v", err)
+		}
+		return
+	}
+
+	startBlock, latestBlock := scanRange(ctx, client)
+
+	cfg := scanConfig{
+		StartBlock:       startBlock,
+		EndBlock:         latestBlock,
+		ChunkSize:        *chunkSize,
+		WithApprovals:    *withApprovals,
+		RetryOnEmpty:     *retryOnEmpty,
+		RawLogsPath:      *rawLogsPath,
+		SkipDecodeErrors: *skipDecodeErrors,
+		Filters:          filters,
+		Parallel:         *parallel,
+		StrictTopics:     *strictTopics,
+		Reverse:          *reverse,
+		MaxResults:       *maxResults,
+		Token:            tokenAddress,
+	}
+	opts := outputOptions{Decimals: decimals, Precision: *precision, CSVPrecision: *csvPrecision, Symbol: token.Symbol, CanonicalJSON: *canonicalJSON, Unit: *unit}
+
+	if *serveAddr != "" {
+		if *serveMaxRange == 0 {
+			fatalf(EXIT_BAD_INPUT, "-serve-max-range must be positive")
+		}
+		server := &transferServer{
+			head:     &headCache{client: client},
+			logs:     pool,
+			cfg:      cfg,
+			opts:     opts,
+			maxRange: *serveMaxRange,
+			watch: watchConfig{
+				PollInterval:    *pollInterval,
+				ReorgDepth:      *reorgDepth,
+				DedupeWindow:    *dedupeWindow,
+				HeadLagInterval: *headLag,
+				Adaptive:        *pollAdaptive,
+				MinPoll:         *pollMin,
+				MaxPoll:         *pollMax,
+			},
+		}
+		if *serveCache {
+			// Blocks within -reorg-depth of the head may still change
+			server.useCache(func(ctx context.Context) (uint64, error) {
+				head, err := server.head.Head(ctx)
+				if err != nil || head < *reorgDepth {
+					return 0, err
+				}
+				return head - *reorgDepth, nil
+			})
+		}
+		err = serve(ctx, *serveAddr, server, serverTimeouts{Read: *readTimeout, Write: *writeTimeout, Idle: *idleTimeout, Shutdown: *drainTimeout})
+		if err != nil {
+			fatalf(EXIT_FAILURE, "REST API server stopped: %v", err)
+		}
+		return
+	}
+
+	if *estimateMode {
+		est, err := estimateLogs(ctx, pool, cfg)
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to estimate USDC transfers: %v", err)
+		}
+		printEstimate(os.Stdout, est, cfg)
+		return
 	}
 
-	fmt.Printf("Found %d USDC transfer records between blocks %d and %d\n", len(logs), startBlock, endBlock)
+	if *snapshotMode {
+		if *concurrency <= 0 {
+			fatalf(EXIT_BAD_INPUT, "-concurrency must be positive")
+		}
+		if *batchSize <= 0 {
+			fatalf(EXIT_BAD_INPUT, "-multicall-batch must be positive")
+		}
+		snapshot := snapshotConfig{
+			Scan:        cfg,
+			Block:       latestBlock,
+			BatchSize:   *batchSize,
+			Concurrency: *concurrency,
+			WithPct:     *snapshotPct,
+		}
+		if *addressesFile != "" {
+			snapshot.Addresses, err = readAddresses(*addressesFile)
+			if err != nil {
+				fatalf(EXIT_BAD_INPUT, "Failed to read addresses: %v", err)
+			}
+		}
+		w, err := openReport(*outPath)
+		if err != nil {
+			fatalf(EXIT_FAILURE, "Failed to open output: %v", err)
+		}
+		err = balanceSnapshot(ctx, client, pool, snapshot, opts, w, *format)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to take USDC balance snapshot: %v", err)
+		}
+		return
+	}
+
+	if *supplyHistoryMode {
+		if *supplyInterval == 0 {
+			fatalf(EXIT_BAD_INPUT, "-interval must be positive")
+		}
+		w, err := openReport(*outPath)
+		if err != nil {
+			fatalf(EXIT_FAILURE, "Failed to open output: %v", err)
+		}
+		err = supplyHistory(ctx, usdc, startBlock, latestBlock, *supplyInterval, opts, w, *format)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to get USDC supply history: %v", err)
+		}
+		return
+	}
+
+	if *sumByDayMode {
+		w, err := openReport(*outPath)
+		if err != nil {
+			fatalf(EXIT_FAILURE, "Failed to open output: %v", err)
+		}
+		err = sumByDay(ctx, client, pool, cfg, opts, w, *format)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to sum USDC transfers by day: %v", err)
+		}
+		return
+	}
+
+	if *discoverMode {
+		w, err := openReport(*outPath)
+		if err != nil {
+			fatalf(EXIT_FAILURE, "Failed to open output: %v", err)
+		}
+		err = discoverEvents(ctx, pool, cfg, w, *format)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to discover the token's events: %v", err)
+		}
+		return
+	}
+
+	if *activityMode {
+		w, err := openReport(*outPath)
+		if err != nil {
+			fatalf(EXIT_FAILURE, "Failed to open output: %v", err)
+		}
+		err = activityReport(ctx, pool, cfg, opts, w, *format)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to report USDC activity by address: %v", err)
+		}
+		return
+	}
+
+	if *feeHistoryMode {
+		if *feeBucket == 0 {
+			fatalf(EXIT_BAD_INPUT, "-bucket must be positive")
+		}
+		w, err := openReport(*outPath)
+		if err != nil {
+			fatalf(EXIT_FAILURE, "Failed to open output: %v", err)
+		}
+		err = feeHistory(ctx, client, pool, cfg, *feeBucket, opts, w, *format)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to correlate USDC volume with the fee history: %v", err)
+		}
+		return
+	}
 
-	divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	var state *scanState
+	if *fullMode {
+		state, err = loadScanState(*statePath, tokenAddress)
+		if err != nil {
+			fatalf(EXIT_BAD_INPUT, "Failed to load -state: %v", err)
+		}
+		appendOutputs = state.Checkpoint != nil
+	}
 
-	for _, vLog := range logs {
-		from := common.HexToAddress(vLog.Topics[1].Hex())
-		to := common.HexToAddress(vLog.Topics[2].Hex())
-		amount := new(big.Int).SetBytes(vLog.Data)
-		amount = new(big.Int).Div(amount, divisor)
+	var sink Sink
+	var export *exportWriter
+	if *exportTo != "" {
+		// Unbuffered, so every checkpoint covers the records written before it
+		export, err = openExport(*exportTo, state, cfg.EndBlock, opts)
+		sink = export
+	} else {
+		sink, err = openSinks(sinkSpecs, *rotateSize, opts, buffer)
+	}
+	if err != nil {
+		fatalf(EXIT_FAILURE, "Failed to open output: %v", err)
+	}
+	sink = withTrace(ctx, sink, client.Client(), tokenAddress, *traceFlag)
+	sink, checksum := withChecksum(sink, *checksumFlag)
+	sink = withHandlers(ctx, sink)
 
-		transferType := "Transfer"
-		if from == common.HexToAddress("0x0000000000000000000000000000000000000000") {
-			transferType = "Mint"
+	if *watch {
+		if *metricsAddr != "" {
+			go func() {
+				log.Printf("Serving metrics on http://%s/debug/vars", *metricsAddr)
+				log.Printf("Metrics server stopped: %v", http.ListenAndServe(*metricsAddr, nil))
+			}()
 		}
+		summary, err := watchTransfers(ctx, client, pool, watchConfig{
+			Scan:            cfg,
+			PollInterval:    *pollInterval,
+			ReorgDepth:      *reorgDepth,
+			DedupeWindow:    *dedupeWindow,
+			HeadLagInterval: *headLag,
+			Adaptive:        *pollAdaptive,
+			MinPoll:         *pollMin,
+			MaxPoll:         *pollMax,
+		}, sink)
+		if closeErr := sink.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to watch USDC transfers: %v", err)
+		}
+		summary.Dropped = droppedRecords(sink)
+		printSummary(infoOut, summary, opts)
+		printChecksum(checksum)
+		return
+	}
 
-		fmt.Printf("Block #%d: %s from %s to %s, amount: %s USDC\n",
-			vLog.BlockNumber, transferType, from.Hex(), to.Hex(), amount.String())
+	if *fullMode {
+		var checkpoint func(state *scanState) error
+		if export != nil {
+			checkpoint = export.Checkpoint
+		}
+		summary, err := fullScan(ctx, client, pool, cfg, state, *statePath, sink, checkpoint)
+		if closeErr := sink.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to scan USDC transfers since deployment: %v", err)
+		}
+		summary.Dropped = droppedRecords(sink)
+		printSummary(infoOut, summary, opts)
+		printChecksum(checksum)
+		if export != nil && state.ExportOffset != nil {
+			fmt.Fprintf(infoOut, "Exported %d records from blocks %d to %d to %s (%d bytes)\n", state.Exported, *state.DeploymentBlock, cfg.EndBlock, *exportTo, *state.ExportOffset)
+		}
+		if len(state.Gaps) > 0 {
+			fatalf(EXIT_RPC, "%d gaps could not be scanned; with -state another run retries them", len(state.Gaps))
+		}
+		return
 	}
 
-	return nil
+	// Query USDC transfer records
+	summary, err := getUSDCTransfers(ctx, pool, cfg, sink)
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fatalf(failureCode(ctx, err), "Failed to query USDC transfer records: %v", err)
+	}
+	summary.Dropped = droppedRecords(sink)
+	printSummary(infoOut, summary, opts)
+	printChecksum(checksum)
+	if *verbose {
+		log.Printf("RPC endpoint scores: %s", pool.Scores())
+	}
+	if summary.Count+summary.Approvals == 0 {
+		exit(EXIT_EMPTY)
+	}
+}
+
+// replay decodes saved raw logs into the sinks, without any RPC. Without a
+// node to ask for the chain ID, -token is resolved on mainnet.
+func replay(path string, sinkSpecs []sinkSpec, buffer bufferConfig, filters []transferFilter, registry *tokenList) {
+	token := defaultTokens.Tokens[0]
+	if *tokenFlag != "" {
+		var err error
+		token, err = registry.Resolve(MAINNET_CHAIN_ID, *tokenFlag)
+		if err != nil {
+			fatalf(EXIT_BAD_INPUT, "Failed to resolve -token: %v", err)
+		}
+	}
+	decimals := uint8(USDC_DEFAULT_DECIMALS)
+	if token.Symbol != "" {
+		decimals = token.Decimals
+	} else {
+		token.Symbol = token.Address
+	}
+	if *decimalsFlag >= 0 {
+		decimals = uint8(*decimalsFlag)
+	}
+	cfg := scanConfig{
+		EndBlock:         math.MaxUint64,
+		WithApprovals:    *withApprovals,
+		SkipDecodeErrors: *skipDecodeErrors,
+		Filters:          filters,
+		StrictTopics:     *strictTopics,
+		Reverse:          *reverse,
+		MaxResults:       *maxResults,
+	}
+	if *tokenFlag != "" {
+		cfg.Token = common.HexToAddress(token.Address)
+	}
+	if *fromBlock >= 0 {
+		cfg.StartBlock = uint64(*fromBlock)
+	}
+	if *toBlock >= 0 {
+		cfg.EndBlock = uint64(*toBlock)
+	}
+
+	opts := outputOptions{Decimals: decimals, Precision: *precision, CSVPrecision: *csvPrecision, Symbol: token.Symbol, CanonicalJSON: *canonicalJSON, Unit: *unit}
+	sink, err := openSinks(sinkSpecs, *rotateSize, opts, buffer)
+	if err != nil {
+		fatalf(EXIT_FAILURE, "Failed to open output: %v", err)
+	}
+	sink, checksum := withChecksum(sink, *checksumFlag)
+	sink = withHandlers(context.Background(), sink)
+	summary, err := replayLogs(path, cfg, sink)
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fatalf(EXIT_BAD_INPUT, "Failed to replay raw logs: %v", err)
+	}
+	summary.Dropped = droppedRecords(sink)
+	printSummary(infoOut, summary, opts)
+	printChecksum(checksum)
+	if summary.Count+summary.Approvals == 0 {
+		exit(EXIT_EMPTY)
+	}
 }
 
 // NewUSDC creates a new USDC instance
@@ -114,15 +825,17 @@ func NewUSDC(address common.Address, backend bind.ContractBackend) (USDC, error)
 		return nil, err
 	}
 	contract := bind.NewBoundContract(address, parsed, backend, backend, backend)
-	return &usdcCaller{contract: contract}, nil
+	return &usdcCaller{contract: contract, address: address, backend: backend}, nil
 }
 
-// USDC ABI
-const USDCABI = `[{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[{"name":"newImplementation","type":"address"}],"name":"upgradeTo","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":false,"inputs":[{"name":"newImplementation","type":"address"},{"name":"data","type":"bytes"}],"name":"upgradeToAndCall","outputs":[],"payable":true,"stateMutability":"payable","type":"function"},{"constant":true,"inputs":[],"name":"implementation","outputs":[{"name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"name":"newAdmin","type":"address"}],"name":"changeAdmin","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[],"name":"admin","outputs":[{"name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"inputs":[{"name":"_implementation","type":"address"}],"payable":false,"stateMutability":"nonpayable","type":"constructor"},{"payable":true,"stateMutability":"payable","type":"fallback"},{"anonymous":false,"inputs":[{"indexed":false,"name":"previousAdmin","type":"address"},{"indexed":false,"name":"newAdmin","type":"address"}],"name":"AdminChanged","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"implementation","type":"address"}],"name":"Upgraded","type":"event"}]`
+// USDC ABI: the proxy functions plus the FiatToken functions and events it delegates to
+const USDCABI = `[{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[{"name":"newImplementation","type":"address"}],"name":"upgradeTo","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":false,"inputs":[{"name":"newImplementation","type":"address"},{"name":"data","type":"bytes"}],"name":"upgradeToAndCall","outputs":[],"payable":true,"stateMutability":"payable","type":"function"},{"constant":true,"inputs":[],"name":"implementation","outputs":[{"name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"name":"newAdmin","type":"address"}],"name":"changeAdmin","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[],"name":"admin","outputs":[{"name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"inputs":[{"name":"_implementation","type":"address"}],"payable":false,"stateMutability":"nonpayable","type":"constructor"},{"payable":true,"stateMutability":"payable","type":"fallback"},{"anonymous":false,"inputs":[{"indexed":false,"name":"previousAdmin","type":"address"},{"indexed":false,"name":"newAdmin","type":"address"}],"name":"AdminChanged","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"implementation","type":"address"}],"name":"Upgraded","type":"event"},{"constant":true,"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"symbol","outputs":[{"name":"","type":"string"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[{"name":"account","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[{"name":"_account","type":"address"}],"name":"isBlacklisted","outputs":[{"name":"","type":"bool"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"paused","outputs":[{"name":"","type":"bool"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"owner","outputs":[{"name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"spender","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Approval","type":"event"}]`
 
 // struct
 type usdcCaller struct {
 	contract *bind.BoundContract
+	address  common.Address
+	backend  bind.ContractBackend
 }
 
 // Decimals
@@ -130,7 +843,146 @@ func (u *usdcCaller) Decimals(opts *bind.CallOpts) (uint8, error) {
 	var out []interface{}
 	err := u.contract.Call(opts, &out, "decimals")
 	if err != nil {
-		return 0, err
+		return 0, withRevertReason(err)
 	}
 	return *abi.ConvertType(out[0], new(uint8)).(*uint8), nil
 }
+
+// DecimalsCtx calls decimals() with ctx, so the call is cancelled with it
+func (u *usdcCaller) DecimalsCtx(ctx context.Context) (uint8, error) {
+	return u.Decimals(&bind.CallOpts{Context: ctx})
+}
+
+// DecimalsOrDefault returns the decimals, or fallback if the call fails or takes
+// longer than timeout, so a slow metadata call doesn't stop the log scan.
+// If decimals() fails on the proxy it is tried once more directly on the
+// implementation contract before giving up.
+func (u *usdcCaller) DecimalsOrDefault(ctx context.Context, timeout time.Duration, fallback uint8) uint8 {
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	callCtx, span := tracer.Start(callCtx, "decimals")
+	decimals, err := u.DecimalsCtx(callCtx)
+	endSpan(span, err)
+	if err == nil {
+		return decimals
+	}
+	log.Printf("Failed to get USDC decimal places from the proxy: %v", err)
+
+	implCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	decimals, err = u.implementationDecimals(implCtx)
+	if err == nil {
+		log.Printf("WARNING: using decimals() of the implementation contract: %d", decimals)
+		return decimals
+	}
+
+	log.Printf("Failed to get USDC decimal places, using %d: %v", fallback, err)
+	return fallback
+}
+
+// implementationDecimals calls decimals() directly on the proxy's implementation contract
+func (u *usdcCaller) implementationDecimals(ctx context.Context) (uint8, error) {
+	reader, ok := u.backend.(storageReader)
+	if !ok {
+		return 0, fmt.Errorf("backend can't read the proxy implementation slot")
+	}
+	implementation, source, err := proxyImplementation(ctx, reader, u.address)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Calling decimals() on implementation %s from the %s", implementation.Hex(), source)
+
+	impl, err := NewUSDC(implementation, u.backend)
+	if err != nil {
+		return 0, err
+	}
+	return impl.DecimalsCtx(ctx)
+}
+
+// Name
+func (u *usdcCaller) Name(opts *bind.CallOpts) (string, error) {
+	var out []interface{}
+	err := u.contract.Call(opts, &out, "name")
+	if err != nil {
+		return "", withRevertReason(err)
+	}
+	return *abi.ConvertType(out[0], new(string)).(*string), nil
+}
+
+// NameCtx calls name() with ctx
+func (u *usdcCaller) NameCtx(ctx context.Context) (string, error) {
+	return u.Name(&bind.CallOpts{Context: ctx})
+}
+
+// Symbol
+func (u *usdcCaller) Symbol(opts *bind.CallOpts) (string, error) {
+	var out []interface{}
+	err := u.contract.Call(opts, &out, "symbol")
+	if err != nil {
+		return "", withRevertReason(err)
+	}
+	return *abi.ConvertType(out[0], new(string)).(*string), nil
+}
+
+// SymbolCtx calls symbol() with ctx
+func (u *usdcCaller) SymbolCtx(ctx context.Context) (string, error) {
+	return u.Symbol(&bind.CallOpts{Context: ctx})
+}
+
+// Admin
+func (u *usdcCaller) Admin(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := u.contract.Call(opts, &out, "admin")
+	if err != nil {
+		return common.Address{}, withRevertReason(err)
+	}
+	return *abi.ConvertType(out[0], new(common.Address)).(*common.Address), nil
+}
+
+// AdminCtx calls admin() with ctx
+func (u *usdcCaller) AdminCtx(ctx context.Context) (common.Address, error) {
+	return u.Admin(&bind.CallOpts{Context: ctx})
+}
+
+// TotalSupply
+func (u *usdcCaller) TotalSupply(opts *bind.CallOpts) (*big.Int, error) {
+	var out []interface{}
+	err := u.contract.Call(opts, &out, "totalSupply")
+	if err != nil {
+		return nil, withRevertReason(err)
+	}
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
+}
+
+// TotalSupplyCtx calls totalSupply() with ctx
+func (u *usdcCaller) TotalSupplyCtx(ctx context.Context) (*big.Int, error) {
+	return u.TotalSupply(&bind.CallOpts{Context: ctx})
+}
+
+// scanRange resolves -from and -to, by default the last 100 blocks
+func scanRange(ctx context.Context, client *ethclient.Client) (uint64, uint64) {
+	// Get the latest block number, unless -to is given
+	var latestBlock uint64
+	if *toBlock >= 0 {
+		latestBlock = uint64(*toBlock)
+	} else {
+		header, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			fatalf(failureCode(ctx, err), "Failed to get the latest block number: %v", err)
+		}
+		latestBlock = header.Number.Uint64()
+	}
+
+	// Calculate the start block number (last 100 blocks)
+	var startBlock uint64
+	if *fromBlock >= 0 {
+		startBlock = uint64(*fromBlock)
+	} else if latestBlock >= 99 {
+		startBlock = latestBlock - 99
+	}
+	if startBlock > latestBlock {
+		fatalf(EXIT_BAD_INPUT, "-from %d is after -to %d", startBlock, latestBlock)
+	}
+	return startBlock, latestBlock
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+// fakeCaller answers contract calls with call; the rest of the backend is unused
+type fakeCaller struct {
+	bind.ContractBackend
+	call func(ctx context.Context) ([]byte, error)
+}
+
+func (f *fakeCaller) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	return f.call(ctx)
+}
+
+// slowCall blocks until ctx is done
+func slowCall(ctx context.Context) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestDecimalsOrDefault(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		call func(ctx context.Context) ([]byte, error)
+		want uint8
+	}{
+		{"ok", func(ctx context.Context) ([]byte, error) { return common.LeftPadBytes([]byte{18}, 32), nil }, 18},
+		{"failing", func(ctx context.Context) ([]byte, error) { return nil, errors.New("execution reverted") }, 6},
+		{"slow", slowCall, 6},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			usdc, err := NewUSDC(common.HexToAddress(USDC_CONTRACT_ADDRESS), &fakeCaller{call: tt.call})
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			if got := usdc.DecimalsOrDefault(context.Background(), 50*time.Millisecond, 6); got != tt.want {
+				t.Errorf("DecimalsOrDefault = %d, want %d", got, tt.want)
+			}
+			// The proxy and the implementation attempt get one timeout each
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("DecimalsOrDefault took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestDecimalsFromImplementation(t *testing.T) {
+	proxy := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	implementation := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		// Reverts every call, like a proxy whose storage layout breaks decimals()
+		proxy: {
+			Code:    common.FromHex("0x60006000fd"),
+			Storage: map[common.Hash]common.Hash{common.HexToHash(ZOS_IMPLEMENTATION_SLOT): common.BytesToHash(implementation.Bytes())},
+		},
+		// Returns uint256(6) for every call
+		implementation: {Code: common.FromHex("0x600660005260206000f3")},
+	})
+	defer backend.Close()
+
+	usdc, err := NewUSDC(proxy, backend.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := usdc.DecimalsCtx(context.Background()); err == nil {
+		t.Fatal("decimals() on the proxy didn't revert")
+	}
+	if got := usdc.DecimalsOrDefault(context.Background(), 5*time.Second, 18); got != 6 {
+		t.Errorf("DecimalsOrDefault = %d, want 6 from the implementation", got)
+	}
+
+	// Without an implementation in the slots the fallback applies
+	empty := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	backend = simulated.NewBackend(types.GenesisAlloc{empty: {Code: common.FromHex("0x60006000fd")}})
+	defer backend.Close()
+	usdc, err = NewUSDC(empty, backend.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usdc.DecimalsOrDefault(context.Background(), 5*time.Second, 18); got != 18 {
+		t.Errorf("DecimalsOrDefault = %d, want the fallback 18", got)
+	}
+}
+
+func TestCancelAbortsSlowMetadataCall(t *testing.T) {
+	usdc, err := NewUSDC(common.HexToAddress(USDC_CONTRACT_ADDRESS), &fakeCaller{call: slowCall})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	for name, call := range map[string]func(ctx context.Context) error{
+		"decimals": func(ctx context.Context) error { _, err := usdc.DecimalsCtx(ctx); return err },
+		"symbol":   func(ctx context.Context) error { _, err := usdc.SymbolCtx(ctx); return err },
+		"name":     func(ctx context.Context) error { _, err := usdc.NameCtx(ctx); return err },
+	} {
+		if err := call(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: err = %v, want context.Canceled", name, err)
+		}
+	}
+	// The timeout alone would take a minute
+	if got := usdc.DecimalsOrDefault(ctx, time.Minute, 6); got != 6 {
+		t.Errorf("DecimalsOrDefault = %d, want the fallback", got)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the calls took %s after the cancellation", elapsed)
+	}
+}
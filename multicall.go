@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Multicall3 is deployed at the same address on mainnet and most other chains
+const MULTICALL3_ADDRESS = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+// Multicall3 ABI, aggregate3 only
+const MULTICALL3_ABI = `[{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+// Default number of balanceOf calls packed into one aggregate3 call
+const MULTICALL_BATCH_SIZE = 500
+
+// errBatchRejected marks an aggregate3 call that reverted or hit a gas or size
+// limit of the endpoint, which a smaller batch may pass
+var errBatchRejected = errors.New("aggregate3 call rejected")
+
+// isBatchLimitErr reports whether err looks like a call too large for the endpoint
+func isBatchLimitErr(err error) bool {
+	if _, ok := err.(rpc.DataError); ok {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"revert", "out of gas", "gas limit", "gas required exceeds", "too large", "exceeds"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// balancesAt returns the token balances of addresses at block, packing batchSize
+// balanceOf calls per Multicall3 aggregate3 call and running up to concurrency
+// of those calls at once
+func balancesAt(ctx context.Context, client *ethclient.Client, token common.Address, addresses []common.Address, block *big.Int, batchSize int, concurrency int) ([]*big.Int, error) {
+	tokenABI, err := abi.JSON(strings.NewReader(USDCABI))
+	if err != nil {
+		return nil, err
+	}
+	multicallABI, err := abi.JSON(strings.NewReader(MULTICALL3_ABI))
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make([]*big.Int, len(addresses))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, concurrency)
+	for start := 0; start < len(addresses); start += batchSize {
+		end := min(start+batchSize, len(addresses))
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			batch, err := splitBalanceBatch(ctx, client, tokenABI, multicallABI, token, addresses[start:end], block)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				cancel()
+				return
+			}
+			copy(balances[start:end], batch)
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+// splitBalanceBatch is balanceBatch, halving a rejected batch and retrying
+// both halves until single calls are rejected
+func splitBalanceBatch(ctx context.Context, client ethereum.ContractCaller, tokenABI abi.ABI, multicallABI abi.ABI, token common.Address, addresses []common.Address, block *big.Int) ([]*big.Int, error) {
+	balances, err := balanceBatch(ctx, client, tokenABI, multicallABI, token, addresses, block)
+	if err == nil || !errors.Is(err, errBatchRejected) || len(addresses) == 1 || ctx.Err() != nil {
+		return balances, err
+	}
+	half := len(addresses) / 2
+	log.Printf("Retrying a rejected batch of %d balanceOf calls as two of %d and %d, consider a smaller -multicall-batch: %v", len(addresses), half, len(addresses)-half, err)
+	first, err := splitBalanceBatch(ctx, client, tokenABI, multicallABI, token, addresses[:half], block)
+	if err != nil {
+		return nil, err
+	}
+	second, err := splitBalanceBatch(ctx, client, tokenABI, multicallABI, token, addresses[half:], block)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// balanceBatch queries the balances of one batch with a single aggregate3 call
+func balanceBatch(ctx context.Context, client ethereum.ContractCaller, tokenABI abi.ABI, multicallABI abi.ABI, token common.Address, addresses []common.Address, block *big.Int) ([]*big.Int, error) {
+	calls := make([]multicall3Call, len(addresses))
+	for i, address := range addresses {
+		data, err := tokenABI.Pack("balanceOf", address)
+		if err != nil {
+			return nil, err
+		}
+		calls[i] = multicall3Call{Target: token, CallData: data}
+	}
+
+	data, err := multicallABI.Pack("aggregate3", calls)
+	if err != nil {
+		return nil, err
+	}
+	multicall := common.HexToAddress(MULTICALL3_ADDRESS)
+	result, err := client.CallContract(ctx, ethereum.CallMsg{To: &multicall, Data: data}, block)
+	if err != nil && ctx.Err() == nil && isBatchLimitErr(err) {
+		return nil, rpcFailure(fmt.Errorf("%w with %d balanceOf calls: %v", errBatchRejected, len(calls), withRevertReason(err)))
+	}
+	if err != nil {
+		return nil, rpcFailure(fmt.Errorf("Failed to call aggregate3 with %d balanceOf calls: %v", len(calls), withRevertReason(err)))
+	}
+
+	out, err := multicallABI.Unpack("aggregate3", result)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode aggregate3 result: %v", err)
+	}
+	results := *abi.ConvertType(out[0], new([]multicall3Result)).(*[]multicall3Result)
+	if len(results) != len(addresses) {
+		return nil, fmt.Errorf("aggregate3 returned %d results for %d calls", len(results), len(addresses))
+	}
+
+	balances := make([]*big.Int, len(addresses))
+	for i, r := range results {
+		if !r.Success {
+			if reason, ok := revertDataReason(r.ReturnData); ok {
+				return nil, fmt.Errorf("balanceOf(%s) reverted: %s", addresses[i].Hex(), reason)
+			}
+			return nil, fmt.Errorf("balanceOf(%s) failed", addresses[i].Hex())
+		}
+		values, err := tokenABI.Unpack("balanceOf", r.ReturnData)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode balanceOf(%s): %v", addresses[i].Hex(), err)
+		}
+		balances[i] = *abi.ConvertType(values[0], new(*big.Int)).(**big.Int)
+	}
+	return balances, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// limitedMulticall answers aggregate3 calls of up to limit balanceOf calls,
+// each address's balance being its last byte, and reverts larger ones
+type limitedMulticall struct {
+	t            *testing.T
+	tokenABI     abi.ABI
+	multicallABI abi.ABI
+	limit        int
+	batches      []int
+}
+
+func (m *limitedMulticall) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	args, err := m.multicallABI.Methods["aggregate3"].Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	calls := *abi.ConvertType(args[0], new([]multicall3Call)).(*[]multicall3Call)
+	m.batches = append(m.batches, len(calls))
+	if len(calls) > m.limit {
+		return nil, errors.New("execution reverted: out of gas")
+	}
+	results := make([]multicall3Result, len(calls))
+	for i, call := range calls {
+		address := common.BytesToAddress(call.CallData[4:])
+		balance, err := m.tokenABI.Methods["balanceOf"].Outputs.Pack(big.NewInt(int64(address[19])))
+		if err != nil {
+			m.t.Fatal(err)
+		}
+		results[i] = multicall3Result{Success: true, ReturnData: balance}
+	}
+	return m.multicallABI.Methods["aggregate3"].Outputs.Pack(results)
+}
+
+func TestSplitBalanceBatch(t *testing.T) {
+	tokenABI, err := abi.JSON(strings.NewReader(USDCABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	multicallABI, err := abi.JSON(strings.NewReader(MULTICALL3_ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addresses []common.Address
+	for i := range 10 {
+		addresses = append(addresses, common.BytesToAddress([]byte{byte(i + 1)}))
+	}
+
+	for _, tt := range []struct {
+		limit   int
+		batches []int
+	}{
+		{10, []int{10}},
+		{5, []int{10, 5, 5}},
+		{3, []int{10, 5, 2, 3, 5, 2, 3}},
+		{1, []int{10, 5, 2, 1, 1, 3, 1, 2, 1, 1, 5, 2, 1, 1, 3, 1, 2, 1, 1}},
+	} {
+		client := &limitedMulticall{t: t, tokenABI: tokenABI, multicallABI: multicallABI, limit: tt.limit}
+		balances, err := splitBalanceBatch(context.Background(), client, tokenABI, multicallABI, common.HexToAddress(USDC_CONTRACT_ADDRESS), addresses, nil)
+		if err != nil {
+			t.Fatalf("limit %d: %v", tt.limit, err)
+		}
+		for i, balance := range balances {
+			if balance.Int64() != int64(i+1) {
+				t.Errorf("limit %d: balance %d = %s, want %d", tt.limit, i, balance, i+1)
+			}
+		}
+		if len(balances) != len(addresses) || !slices.Equal(client.batches, tt.batches) {
+			t.Errorf("limit %d: got %d balances in batches %v, want %d in %v", tt.limit, len(balances), client.batches, len(addresses), tt.batches)
+		}
+	}
+
+	// Single calls that are still rejected fail the query
+	client := &limitedMulticall{t: t, tokenABI: tokenABI, multicallABI: multicallABI, limit: 0}
+	if _, err := splitBalanceBatch(context.Background(), client, tokenABI, multicallABI, common.HexToAddress(USDC_CONTRACT_ADDRESS), addresses[:2], nil); !errors.Is(err, errBatchRejected) {
+		t.Errorf("err = %v, want errBatchRejected", err)
+	}
+}
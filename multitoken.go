@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// How many -tokens are scanned at the same time. They share the endpoint
+// pool, so -rate-limit applies to all of them together.
+const MULTI_TOKEN_CONCURRENCY = 4
+
+// File extensions of the -tokens outputs by format
+var formatExtensions = map[string]string{
+	FORMAT_TEXT:   ".txt",
+	FORMAT_CSV:    ".csv",
+	FORMAT_NDJSON: ".ndjson",
+}
+
+// tokenMetadata controls how -tokens resolves each token, as for -token
+type tokenMetadata struct {
+	Skip     bool // -no-metadata
+	Decimals int  // -decimals, or -1 to read them
+	Timeout  time.Duration
+}
+
+// tokenScan is the outcome of scanning one of -tokens
+type tokenScan struct {
+	Name    string // as given in -tokens
+	Token   tokenInfo
+	Opts    outputOptions
+	Path    string
+	Summary *Summary
+	Err     error
+}
+
+// resolveScanToken resolves one of -tokens like main resolves -token:
+// registry symbols and addresses, with the symbol and decimals read on-chain
+// for unlisted tokens unless meta.Skip is set.
+func resolveScanToken(ctx context.Context, client *ethclient.Client, registry *tokenList, name string, meta tokenMetadata) (tokenInfo, uint8, error) {
+	var token tokenInfo
+	if meta.Skip && common.IsHexAddress(name) {
+		token.Address = common.HexToAddress(name).Hex()
+	} else {
+		var err error
+		token, err = resolveToken(ctx, client, registry, name)
+		if err != nil {
+			return tokenInfo{}, 0, err
+		}
+	}
+	listed := token.Symbol != ""
+
+	address := common.HexToAddress(token.Address)
+	contract, err := NewUSDC(address, client)
+	if err != nil {
+		return tokenInfo{}, 0, fmt.Errorf("Failed to create token contract instance: %v", err)
+	}
+	if meta.Skip {
+		token.Symbol = token.Address
+	} else if token.Symbol == "" {
+		token.Symbol = tokenSymbol(ctx, contract, address, meta.Timeout)
+	}
+
+	fallback := uint8(USDC_DEFAULT_DECIMALS)
+	if listed {
+		fallback = token.Decimals
+	}
+	var decimals uint8
+	if meta.Decimals >= 0 {
+		decimals = uint8(meta.Decimals)
+	} else if !meta.Skip {
+		decimals = contract.DecimalsOrDefault(ctx, meta.Timeout, fallback)
+	}
+	return token, decimals, nil
+}
+
+// outputName names the file of a token by its symbol, or by its address when
+// the symbol is unknown, taken by another token or not usable as a file name
+func outputName(token tokenInfo, format string, taken map[string]bool) string {
+	name := token.Symbol
+	if name == "" || strings.ContainsFunc(name, func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) || taken[strings.ToLower(name)] {
+		name = token.Address
+	}
+	taken[strings.ToLower(name)] = true
+	return name + formatExtensions[format]
+}
+
+// scanTokens scans every token of names over cfg's block range, each into
+// its own file in dir, MULTI_TOKEN_CONCURRENCY at a time. A token that fails
+// to resolve or scan is reported in its tokenScan without stopping the others.
+// With a buffer size each file is written through its own -sink-buffer.
+func scanTokens(ctx context.Context, client *ethclient.Client, logs logFilterer, registry *tokenList, names []string, meta tokenMetadata, cfg scanConfig, opts outputOptions, format string, dir string, rotateSize int64, buffer bufferConfig) []*tokenScan {
+	scans := make([]*tokenScan, len(names))
+	taken := make(map[string]bool)
+	seen := make(map[string]string) // address to name
+	for i, name := range names {
+		scan := &tokenScan{Name: name}
+		scans[i] = scan
+		token, decimals, err := resolveScanToken(ctx, client, registry, name, meta)
+		if err != nil {
+			scan.Err = fmt.Errorf("Failed to resolve the token: %w", err)
+			continue
+		}
+		if other, ok := seen[token.Address]; ok {
+			scan.Err = fmt.Errorf("%s is also listed as %s", token.Address, other)
+			continue
+		}
+		seen[token.Address] = name
+		scan.Token = token
+		scan.Opts = opts
+		scan.Opts.Decimals, scan.Opts.Symbol = decimals, token.Symbol
+		scan.Path = filepath.Join(dir, outputName(token, format, taken))
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, MULTI_TOKEN_CONCURRENCY)
+	for _, scan := range scans {
+		if scan.Err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			scan.Summary, scan.Err = scanToken(ctx, logs, cfg, scan, format, rotateSize, buffer)
+			if scan.Err != nil {
+				log.Printf("Failed to scan %s: %v", scan.Name, scan.Err)
+			}
+		}()
+	}
+	wg.Wait()
+	return scans
+}
+
+// scanToken scans one token into its file
+func scanToken(ctx context.Context, logs logFilterer, cfg scanConfig, scan *tokenScan, format string, rotateSize int64, buffer bufferConfig) (*Summary, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	cfg.Token = common.HexToAddress(scan.Token.Address)
+	sink, err := openSink(format, scan.Path, rotateSize, scan.Opts)
+	if err != nil {
+		return nil, err
+	}
+	if buffer.Size > 0 {
+		sink = newBufferedSink(scan.Path, sink, buffer)
+	}
+	sink = withHandlers(ctx, sink)
+	summary, err := getUSDCTransfers(ctx, logs, cfg, sink)
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	summary.Dropped = droppedRecords(sink)
+	return summary, nil
+}
+
+// printTokenScans prints the summary of every token, in -tokens order, and
+// returns the error of the first failed token and the records of the others
+func printTokenScans(w io.Writer, scans []*tokenScan) (failure error, records int) {
+	failed := 0
+	for _, scan := range scans {
+		if scan.Err != nil {
+			fmt.Fprintf(w, "%s: failed: %v\n", scan.Name, scan.Err)
+			if failure == nil {
+				failure = scan.Err
+			}
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "%s (%s) written to %s\n", scan.Token.Symbol, scan.Token.Address, scan.Path)
+		printSummary(w, scan.Summary, scan.Opts)
+		records += scan.Summary.Count + scan.Summary.Approvals
+	}
+	fmt.Fprintf(w, "Scanned %d of %d tokens\n", len(scans)-failed, len(scans))
+	return failure, records
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestScanTokenBuffered(t *testing.T) {
+	node := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+		var logs []types.Log
+		for block := q.FromBlock.Uint64(); block <= q.ToBlock.Uint64(); block++ {
+			logs = append(logs, testLog(transferTopic, testAlice, testBob, 1_000_000, block, 0))
+		}
+		return logs, nil
+	})
+	scan := &tokenScan{
+		Name:  USDC_CONTRACT_ADDRESS,
+		Token: tokenInfo{Address: USDC_CONTRACT_ADDRESS},
+		Opts:  outputOptions{Decimals: 6},
+		Path:  filepath.Join(t.TempDir(), "USDC.ndjson"),
+	}
+	cfg := scanConfig{StartBlock: 1, EndBlock: 50, ChunkSize: 10}
+	summary, err := scanToken(context.Background(), node, cfg, scan, FORMAT_NDJSON, 0, bufferConfig{Size: 4, Policy: OVERFLOW_BLOCK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(scan.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 50 || summary.Count != 50 {
+		t.Errorf("%s has %d records and the summary %d, want all 50 through the buffer", scan.Path, lines, summary.Count)
+	}
+	if len(summary.Dropped) != 0 {
+		t.Errorf("dropped %v with the block policy", summary.Dropped)
+	}
+}
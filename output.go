@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Output formats
+const (
+	FORMAT_TEXT   = "text"
+	FORMAT_CSV    = "csv"
+	FORMAT_NDJSON = "ndjson"
+)
+
+// CSV columns
+var csvHeader = []string{"block", "tx_hash", "log_index", "type", "from", "to", "amount_raw", "amount_usdc"}
+
+// outputOptions controls how amounts are displayed
+type outputOptions struct {
+	Decimals uint8
+	// Fractional digits of displayed amounts; negative keeps full precision
+	Precision int
+	// Fixed fractional digits of the csv amount_usdc column; negative follows Precision
+	CSVPrecision int
+	// Token symbol shown after text amounts
+	Symbol string
+	// Encode ndjson records with canonicalTransfer
+	CanonicalJSON bool
+	// Scale of text amounts: UNIT_BASE, UNIT_THOUSANDS, UNIT_MILLIONS or UNIT_BILLIONS
+	Unit string
+}
+
+// Display units of -unit
+const (
+	UNIT_BASE      = "base"
+	UNIT_THOUSANDS = "k"
+	UNIT_MILLIONS  = "m"
+	UNIT_BILLIONS  = "b"
+)
+
+// Fractional digits of scaled amounts without -precision
+const UNIT_DEFAULT_PRECISION = 2
+
+// unitScales maps each scaled unit to its power of ten and suffix
+var unitScales = map[string]struct {
+	Exp    int64
+	Suffix string
+}{
+	UNIT_THOUSANDS: {3, "K"},
+	UNIT_MILLIONS:  {6, "M"},
+	UNIT_BILLIONS:  {9, "B"},
+}
+
+// validUnit reports whether unit is a known -unit
+func validUnit(unit string) bool {
+	_, ok := unitScales[unit]
+	return ok || unit == UNIT_BASE
+}
+
+// displayAmount formats an amount for text and csv output
+func (o outputOptions) displayAmount(amount *big.Int) string {
+	if o.Precision < 0 {
+		return formatAmount(amount, o.Decimals)
+	}
+	return roundAmount(amount, o.Decimals, o.Precision)
+}
+
+// textAmount formats an amount for text output, scaled to Unit with a
+// suffix, e.g. "1.50M". Scaled amounts are rounded to Precision digits, or
+// UNIT_DEFAULT_PRECISION without one.
+func (o outputOptions) textAmount(amount *big.Int) string {
+	scale, ok := unitScales[o.Unit]
+	if !ok {
+		return o.displayAmount(amount)
+	}
+	precision := o.Precision
+	if precision < 0 {
+		precision = UNIT_DEFAULT_PRECISION
+	}
+	divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(o.Decimals)+scale.Exp), nil)
+	return new(big.Rat).SetFrac(amount, divisor).FloatString(precision) + scale.Suffix
+}
+
+// reportAmount formats an amount of a report row: scaled in text tables, unscaled in csv and ndjson
+func (o outputOptions) reportAmount(format string, amount *big.Int) string {
+	if format == FORMAT_TEXT {
+		return o.textAmount(amount)
+	}
+	return o.displayAmount(amount)
+}
+
+// csvAmount formats an amount for the amount_usdc column of transfer csv output
+func (o outputOptions) csvAmount(amount *big.Int) string {
+	if o.CSVPrecision < 0 {
+		return o.displayAmount(amount)
+	}
+	return roundAmount(amount, o.Decimals, o.CSVPrecision)
+}
+
+// Sink receives decoded transfers
+type Sink interface {
+	Write(t Transfer) error
+	Close() error
+}
+
+// jsonTransfer is the ndjson record of a transfer
+type jsonTransfer struct {
+	Block     uint64 `json:"block"`
+	TxHash    string `json:"tx_hash"`
+	LogIndex  uint   `json:"log_index"`
+	Type      string `json:"type"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	AmountRaw string `json:"amount_raw"`
+	Amount    string `json:"amount"`
+}
+
+func newJSONTransfer(t Transfer, decimals uint8) jsonTransfer {
+	return jsonTransfer{
+		Block:     t.BlockNumber,
+		TxHash:    t.TxHash.Hex(),
+		LogIndex:  t.LogIndex,
+		Type:      t.Type,
+		From:      t.From.Hex(),
+		To:        t.To.Hex(),
+		AmountRaw: t.Amount.String(),
+		Amount:    formatAmount(t.Amount, decimals),
+	}
+}
+
+// validFormat reports whether format is a known output format
+func validFormat(format string) bool {
+	return format == FORMAT_TEXT || format == FORMAT_CSV || format == FORMAT_NDJSON
+}
+
+// encodeTransfer encodes a transfer as one record, including the trailing newline.
+// ndjson always keeps full precision.
+func encodeTransfer(format string, t Transfer, opts outputOptions) ([]byte, error) {
+	amount := opts.textAmount(t.Amount)
+	if format == FORMAT_CSV {
+		amount = opts.csvAmount(t.Amount)
+	}
+	switch format {
+	case FORMAT_TEXT:
+		if t.Event == EventApproval {
+			return []byte(fmt.Sprintf("Block #%d: Approval by %s for %s, amount: %s %s\n",
+				t.BlockNumber, t.From.Hex(), t.To.Hex(), amount, opts.Symbol)), nil
+		}
+		return []byte(fmt.Sprintf("Block #%d: %s from %s to %s, amount: %s %s\n",
+			t.BlockNumber, t.Type, t.From.Hex(), t.To.Hex(), amount, opts.Symbol)), nil
+	case FORMAT_CSV:
+		return encodeCSV([]string{
+			strconv.FormatUint(t.BlockNumber, 10),
+			t.TxHash.Hex(),
+			strconv.FormatUint(uint64(t.LogIndex), 10),
+			t.Type,
+			t.From.Hex(),
+			t.To.Hex(),
+			t.Amount.String(),
+			amount,
+		})
+	case FORMAT_NDJSON:
+		var record interface{} = newJSONTransfer(t, opts.Decimals)
+		if opts.CanonicalJSON {
+			record = canonicalTransfer(newJSONTransfer(t, opts.Decimals))
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	return nil, fmt.Errorf("Unknown output format %q", format)
+}
+
+// encodeCSV encodes a single csv row
+func encodeCSV(row []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(row)
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// formatSink writes each transfer as one record with a single Write call,
+// so a rotating writer never splits a record across files
+type formatSink struct {
+	w      io.Writer
+	closer io.Closer
+	format string
+	opts   outputOptions
+}
+
+func (s *formatSink) Write(t Transfer) error {
+	record, err := encodeTransfer(s.format, t, s.opts)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(record)
+	return err
+}
+
+func (s *formatSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// openSink opens a sink writing format to path, or to stdout if path is empty.
+// With rotateSize > 0 the output is split into numbered files of about that size.
+func openSink(format string, path string, rotateSize int64, opts outputOptions) (Sink, error) {
+	var header []byte
+	if format == FORMAT_CSV {
+		var err error
+		header, err = encodeCSV(csvHeader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if path == "" {
+		if _, err := os.Stdout.Write(header); err != nil {
+			return nil, err
+		}
+		return &formatSink{w: os.Stdout, format: format, opts: opts}, nil
+	}
+
+	if rotateSize > 0 {
+		w := newRotatingWriter(path, rotateSize, header)
+		return &formatSink{w: w, closer: w, format: format, opts: opts}, nil
+	}
+
+	w, err := createFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if w.appended {
+		header = nil
+	}
+	if _, err := w.Write(header); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return &formatSink{w: w, closer: w, format: format, opts: opts}, nil
+}
+
+// Compression level of .gz outputs
+var gzipLevel = gzip.DefaultCompression
+
+// Append to existing output files instead of replacing them, for resumed scans.
+// A .gz file gets another gzip member, which readers decompress as one stream.
+var appendOutputs = false
+
+// fileWriter is a buffered file that flushes on Close.
+// Files named *.gz are gzip compressed.
+type fileWriter struct {
+	*bufio.Writer
+	gz       *gzip.Writer
+	file     *os.File
+	appended bool // opened with appendOutputs and not empty
+}
+
+func createFile(path string) (*fileWriter, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendOutputs {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0o666)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create output file: %v", err)
+	}
+	appended := false
+	if appendOutputs {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		appended = info.Size() > 0
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return &fileWriter{Writer: bufio.NewWriter(file), file: file, appended: appended}, nil
+	}
+
+	gz, err := gzip.NewWriterLevel(file, gzipLevel)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileWriter{Writer: bufio.NewWriter(gz), gz: gz, file: file, appended: appended}, nil
+}
+
+// Sync writes everything buffered so far to the file and syncs it. A .gz file
+// stays in the current member.
+func (f *fileWriter) Sync() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	if f.gz != nil {
+		if err := f.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return f.file.Sync()
+}
+
+// syncSinks makes the records written to the file outputs in sink durable,
+// before a -full checkpoint claims them
+func syncSinks(sink Sink) error {
+	switch s := sink.(type) {
+	case multiSink:
+		var errs []error
+		for _, child := range s {
+			if err := syncSinks(child); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	case *pipeline:
+		for _, h := range s.handlers {
+			if sh, ok := h.(sinkHandler); ok {
+				return syncSinks(sh.sink)
+			}
+		}
+	case *formatSink:
+		if f, ok := s.w.(*fileWriter); ok {
+			return f.Sync()
+		}
+	}
+	return nil
+}
+
+func (f *fileWriter) Close() error {
+	err := f.Flush()
+	if f.gz != nil {
+		if gzErr := f.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncSinks(t *testing.T) {
+	for _, name := range []string{"transfers.ndjson", "transfers.ndjson.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			file, err := openSink(FORMAT_NDJSON, path, 0, outputOptions{Decimals: 6})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			sink, _ := withChecksum(file, true)
+			if err := sink.Write(decodedTestLog(t)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := syncSinks(sink); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var r io.Reader = f
+			if strings.HasSuffix(name, ".gz") {
+				if r, err = gzip.NewReader(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// The gzip member isn't finished before Close
+			data, err := io.ReadAll(r)
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), `"block":10,`) {
+				t.Errorf("%s has %q after the sync, want the record", name, data)
+			}
+		})
+	}
+}
+
+func decodedTestLog(t *testing.T) Transfer {
+	transfer, err := decodeLog(testLog(transferTopic, testAlice, testBob, 1_000_000, 10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transfer
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Consecutive failures after which an endpoint stops taking chunks in a parallel scan
+const PARALLEL_MAX_FAILURES = 3
+
+// How many chunks per endpoint a parallel scan fetches ahead of the first one
+// not yet passed on, bounding the logs held back to keep the block order
+const PARALLEL_LOOKAHEAD = 4
+
+// chunk is one block range of a parallel scan
+type chunk struct {
+	index    int
+	from, to uint64
+	failedOn map[*endpoint]bool
+	lastErr  error
+}
+
+// chunkResult is a fetched chunk, handed from the workers to the caller
+type chunkResult struct {
+	index int
+	logs  []types.Log
+}
+
+// chunkQueue hands out the chunks of a parallel scan. A chunk that failed on an
+// endpoint is put back for the other endpoints; workers wait while chunks are
+// in flight, since those may still fail and come back. Only chunks within
+// window of the first one not yet emitted are handed out.
+type chunkQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []*chunk
+	inFlight int
+	live     map[*endpoint]bool
+	failed   *chunk // set once a chunk failed on every live endpoint, or the scan stopped
+	stopped  bool
+	emitted  int
+	window   int
+}
+
+func newChunkQueue(chunks []*chunk, endpoints []*endpoint) *chunkQueue {
+	q := &chunkQueue{pending: chunks, live: make(map[*endpoint]bool), window: PARALLEL_LOOKAHEAD * len(endpoints)}
+	for _, e := range endpoints {
+		q.live[e] = true
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// next returns the first pending chunk that didn't fail on e,
+// or nil once there is nothing left that e could take. It waits while the
+// chunks e could take are beyond the window.
+func (q *chunkQueue) next(e *endpoint) *chunk {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.failed == nil && !q.stopped {
+		ahead := false
+		for i, c := range q.pending {
+			if c.failedOn[e] {
+				continue
+			}
+			if c.index >= q.emitted+q.window {
+				ahead = true
+				continue
+			}
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.inFlight++
+			return c
+		}
+		if q.inFlight == 0 && !ahead {
+			return nil
+		}
+		q.cond.Wait()
+	}
+	return nil
+}
+
+// done finishes a chunk taken with next. A failed chunk is put back unless
+// every live endpoint already failed it; with drop, e takes no more chunks,
+// and a pending chunk that only e could still take fails the scan.
+func (q *chunkQueue) done(c *chunk, e *endpoint, err error, drop bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inFlight--
+	if drop {
+		delete(q.live, e)
+	}
+	if err != nil {
+		c.failedOn[e] = true
+		c.lastErr = err
+		if q.untried(c) {
+			q.pending = append(q.pending, c)
+		} else if q.failed == nil {
+			q.failed = c
+		}
+	}
+	if drop && q.failed == nil {
+		for _, p := range q.pending {
+			if !q.untried(p) && (q.failed == nil || p.index < q.failed.index) {
+				q.failed = p
+			}
+		}
+	}
+	q.cond.Broadcast()
+}
+
+// untried reports whether a live endpoint didn't fail c yet
+func (q *chunkQueue) untried(c *chunk) bool {
+	for e := range q.live {
+		if !c.failedOn[e] {
+			return true
+		}
+	}
+	return false
+}
+
+// advance moves the window once the chunks before index were emitted
+func (q *chunkQueue) advance(index int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.emitted = index
+	q.cond.Broadcast()
+}
+
+// stop makes next return nil for every worker
+func (q *chunkQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stopped = true
+	q.cond.Broadcast()
+}
+
+// forEachChunkParallel fetches the chunks of [start, end] concurrently, one
+// worker per endpoint, each respecting the pool's rate limit. The chunks of a
+// failing endpoint are reassigned to the others, and an endpoint that fails
+// PARALLEL_MAX_FAILURES times in a row is dropped. fn is called from the
+// calling goroutine with the logs of each chunk in block order.
+func (p *endpointPool) forEachChunkParallel(ctx context.Context, query ethereum.FilterQuery, cfg scanConfig, fn func(logs []types.Log) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var chunks []*chunk
+	forEachChunk(cfg.StartBlock, cfg.EndBlock, cfg.ChunkSize, func(from uint64, to uint64) error {
+		chunks = append(chunks, &chunk{index: len(chunks), from: from, to: to, failedOn: make(map[*endpoint]bool)})
+		return nil
+	})
+	queue := newChunkQueue(append([]*chunk(nil), chunks...), p.endpoints)
+	results := make(chan chunkResult, len(chunks))
+
+	var wg sync.WaitGroup
+	for _, e := range p.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			failures := 0
+			for c := queue.next(e); c != nil; c = queue.next(e) {
+				logs, err := p.throttledChunk(ctx, e, query, c, cfg.RetryOnEmpty)
+				if err == nil {
+					failures = 0
+					results <- chunkResult{c.index, logs}
+					queue.done(c, e, nil, false)
+					continue
+				}
+				if ctx.Err() != nil {
+					queue.stop()
+					return
+				}
+				failures++
+				drop := failures == PARALLEL_MAX_FAILURES
+				if drop {
+					log.Printf("RPC endpoint %s failed %d times in a row, reassigning its chunks: %v", e.URL, failures, err)
+				} else {
+					log.Printf("RPC endpoint %s failed blocks %d-%d, reassigning them: %v", e.URL, c.from, c.to, err)
+				}
+				queue.done(c, e, err, drop)
+				if drop {
+					return
+				}
+			}
+		}(e)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Emit the chunks in order, holding back the ones that finished early
+	held := make(map[int][]types.Log)
+	emitted := 0
+	for r := range results {
+		held[r.index] = r.logs
+		for logs, ok := held[emitted]; ok; logs, ok = held[emitted] {
+			delete(held, emitted)
+			emitted++
+			queue.advance(emitted)
+			sort.Slice(logs, func(i, j int) bool {
+				if logs[i].BlockNumber != logs[j].BlockNumber {
+					return logs[i].BlockNumber < logs[j].BlockNumber
+				}
+				return logs[i].Index < logs[j].Index
+			})
+			if err := fn(logs); err != nil {
+				cancel()
+				queue.stop()
+				for range results {
+				}
+				return err
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if emitted < len(chunks) {
+		c := chunks[emitted]
+		if failed := queue.failed; failed != nil {
+			c = failed
+		}
+		if c.lastErr != nil {
+			return rpcFailure(fmt.Errorf("Every RPC endpoint failed: %v", c.lastErr))
+		}
+		return rpcFailure(fmt.Errorf("No healthy RPC endpoint left for blocks %d-%d", c.from, c.to))
+	}
+	return nil
+}
+
+// throttledChunk fetches one chunk from e under the rate limit and records the call in e's score
+func (p *endpointPool) throttledChunk(ctx context.Context, e *endpoint, query ethereum.FilterQuery, c *chunk, retryOnEmpty int) ([]types.Log, error) {
+	if err := p.throttle(ctx, e); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	logs, err := fetchChunk(ctx, e.client, query, c.from, c.to, retryOnEmpty)
+	p.record(e, time.Since(start), err)
+	return logs, err
+}
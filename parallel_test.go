@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChunkQueueWindow(t *testing.T) {
+	e := &endpoint{URL: "test"}
+	var chunks []*chunk
+	for i := range 3 * PARALLEL_LOOKAHEAD {
+		chunks = append(chunks, &chunk{index: i, failedOn: make(map[*endpoint]bool)})
+	}
+	queue := newChunkQueue(chunks, []*endpoint{e})
+	for i := range PARALLEL_LOOKAHEAD {
+		c := queue.next(e)
+		if c == nil || c.index != i {
+			t.Fatalf("next = %v, want chunk %d", c, i)
+		}
+		queue.done(c, e, nil, false)
+	}
+
+	// Chunk 0 isn't emitted yet, so the next one waits
+	got := make(chan *chunk)
+	go func() { got <- queue.next(e) }()
+	select {
+	case c := <-got:
+		t.Fatalf("next returned chunk %v beyond the window", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+	queue.advance(1)
+	if c := <-got; c == nil || c.index != PARALLEL_LOOKAHEAD {
+		t.Fatalf("next = %v after advancing, want chunk %d", c, PARALLEL_LOOKAHEAD)
+	}
+}
+
+func TestChunkQueueSingleSurvivor(t *testing.T) {
+	a, b := &endpoint{URL: "a"}, &endpoint{URL: "b"}
+	var chunks []*chunk
+	for i := range 4 * PARALLEL_LOOKAHEAD {
+		chunks = append(chunks, &chunk{index: i, failedOn: make(map[*endpoint]bool)})
+	}
+	queue := newChunkQueue(chunks, []*endpoint{a, b})
+
+	// b fails the first chunk, which stays pending for a
+	first := queue.next(b)
+	queue.done(first, b, errors.New("b failed"), false)
+	// a is dropped on another chunk, leaving the first one to nobody
+	other := queue.next(a)
+	if other == first {
+		t.Fatalf("a took chunk %d, want another one", other.index)
+	}
+	queue.done(other, a, errors.New("a failed"), true)
+
+	// b keeps working, but the window can't move past the first chunk
+	finished := make(chan struct{})
+	go func() {
+		for c := queue.next(b); c != nil; c = queue.next(b) {
+			queue.done(c, b, nil, false)
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("b waits forever for a chunk no live endpoint can take")
+	}
+	if queue.failed != first || queue.failed.lastErr == nil {
+		t.Errorf("failed = %v, want the first chunk with its error", queue.failed)
+	}
+}
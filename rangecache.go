@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// rangeCache is a read-through cache of the logs of one filter for the REST
+// API. It tracks which block ranges are fully indexed and only queries the
+// node for the uncached parts of a request. Blocks newer than safe() may
+// still be reorged and are never cached. Gaps are filled one request at a
+// time, so concurrent clients asking for the same window cause one query. A
+// gap or recent range that comes back empty is retried retryOnEmpty times,
+// as -retry-on-empty does for uncached scans, so the scans reading through
+// the cache don't retry themselves.
+type rangeCache struct {
+	logs         logFilterer
+	query        ethereum.FilterQuery // without a block range
+	retryOnEmpty int
+	safe         func(ctx context.Context) (uint64, error)
+
+	fill    sync.Mutex // held while filling gaps
+	mu      sync.Mutex
+	covered []blockRange // sorted, disjoint and not adjacent
+	blocks  map[uint64][]types.Log
+	order   []uint64 // the keys of blocks, sorted
+	count   int
+}
+
+func newRangeCache(logs logFilterer, query ethereum.FilterQuery, retryOnEmpty int, safe func(ctx context.Context) (uint64, error)) *rangeCache {
+	return &rangeCache{logs: logs, query: query, retryOnEmpty: retryOnEmpty, safe: safe, blocks: make(map[uint64][]types.Log)}
+}
+
+// FilterLogs serves q from the cache, filling its gaps from the node first.
+// Queries for another filter, or without a block range, bypass the cache.
+func (c *rangeCache) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	if q.FromBlock == nil || q.ToBlock == nil || q.BlockHash != nil ||
+		!reflect.DeepEqual(q.Addresses, c.query.Addresses) || !reflect.DeepEqual(q.Topics, c.query.Topics) {
+		return c.logs.FilterLogs(ctx, q)
+	}
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	safe, err := c.safe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if from > safe {
+		return c.fetch(ctx, q, from, to)
+	}
+	cacheable := min(to, safe)
+
+	c.fill.Lock()
+	for _, gap := range c.gaps(from, cacheable) {
+		logs, err := c.fetch(ctx, q, gap.From, gap.To)
+		if err != nil {
+			c.fill.Unlock()
+			return nil, err
+		}
+		c.insert(gap, logs)
+	}
+	c.fill.Unlock()
+
+	logs := c.collect(from, cacheable)
+	if to > cacheable {
+		recent, err := c.fetch(ctx, q, cacheable+1, to)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, recent...)
+	}
+	return logs, nil
+}
+
+// fetch queries the node for [from, to], retrying an empty answer retryOnEmpty times
+func (c *rangeCache) fetch(ctx context.Context, q ethereum.FilterQuery, from uint64, to uint64) ([]types.Log, error) {
+	q.FromBlock = new(big.Int).SetUint64(from)
+	q.ToBlock = new(big.Int).SetUint64(to)
+	logs, err := c.logs.FilterLogs(ctx, q)
+	for attempt := 1; err == nil && len(logs) == 0 && attempt <= c.retryOnEmpty; attempt++ {
+		logs, err = c.logs.FilterLogs(ctx, q)
+	}
+	return logs, err
+}
+
+// gaps returns the parts of [from, to] that aren't covered yet
+func (c *rangeCache) gaps(from uint64, to uint64) []blockRange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var gaps []blockRange
+	next := from
+	for _, r := range c.covered {
+		if r.To < next {
+			continue
+		}
+		if r.From > to {
+			break
+		}
+		if r.From > next {
+			gaps = append(gaps, blockRange{next, r.From - 1})
+		}
+		if r.To >= to {
+			return gaps
+		}
+		next = r.To + 1
+	}
+	return append(gaps, blockRange{next, to})
+}
+
+// insert stores the logs of a fully fetched range and marks it covered
+func (c *rangeCache) insert(r blockRange, logs []types.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var added []uint64
+	for _, vLog := range logs {
+		if _, ok := c.blocks[vLog.BlockNumber]; !ok {
+			added = append(added, vLog.BlockNumber)
+		}
+		c.blocks[vLog.BlockNumber] = append(c.blocks[vLog.BlockNumber], vLog)
+	}
+	c.count += len(logs)
+	// r was a gap, so its blocks go between the cached ones before and after it
+	sort.Slice(added, func(i, j int) bool { return added[i] < added[j] })
+	at := sort.Search(len(c.order), func(i int) bool { return c.order[i] > r.To })
+	c.order = append(c.order[:at], append(added, c.order[at:]...)...)
+
+	covered := append(c.covered, r)
+	sort.Slice(covered, func(i, j int) bool { return covered[i].From < covered[j].From })
+	merged := covered[:1]
+	for _, next := range covered[1:] {
+		last := &merged[len(merged)-1]
+		if next.From <= last.To+1 {
+			last.To = max(last.To, next.To)
+		} else {
+			merged = append(merged, next)
+		}
+	}
+	c.covered = merged
+}
+
+// collect returns the cached logs of the covered range [from, to] in block order
+func (c *rangeCache) collect(from uint64, to uint64) []types.Log {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var logs []types.Log
+	for i := sort.Search(len(c.order), func(i int) bool { return c.order[i] >= from }); i < len(c.order) && c.order[i] <= to; i++ {
+		logs = append(logs, c.blocks[c.order[i]]...)
+	}
+	return logs
+}
+
+// cacheStatus is the body of GET /cache
+type cacheStatus struct {
+	Ranges []blockRange `json:"ranges"`
+	Blocks uint64       `json:"blocks"`
+	Logs   int          `json:"logs"`
+}
+
+// Status describes the fully indexed ranges
+func (c *rangeCache) Status() cacheStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := cacheStatus{Ranges: append([]blockRange{}, c.covered...), Logs: c.count}
+	for _, r := range c.covered {
+		status.Blocks += r.To - r.From + 1
+	}
+	return status
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// rangeQuery is the cache's filter over [from, to]
+func rangeQuery(query ethereum.FilterQuery, from uint64, to uint64) ethereum.FilterQuery {
+	query.FromBlock = new(big.Int).SetUint64(from)
+	query.ToBlock = new(big.Int).SetUint64(to)
+	return query
+}
+
+func TestRangeCacheRetriesEmptyGap(t *testing.T) {
+	query := scanConfig{}.filterQuery()
+	safe := func(ctx context.Context) (uint64, error) { return 1000, nil }
+	for _, tt := range []struct {
+		retryOnEmpty int
+		want         int
+	}{
+		{0, 0}, // the empty answer is taken as is
+		{1, 1},
+	} {
+		calls := 0
+		// A load-balanced node whose first answer misses the logs
+		node := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+			calls++
+			if calls == 1 {
+				return nil, nil
+			}
+			return []types.Log{testLog(transferTopic, testAlice, testBob, 1, 15, 0)}, nil
+		})
+		cache := newRangeCache(node, query, tt.retryOnEmpty, safe)
+		for range 2 {
+			logs, err := cache.FilterLogs(context.Background(), rangeQuery(query, 10, 20))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(logs) != tt.want {
+				t.Errorf("-retry-on-empty %d: got %d logs, want %d", tt.retryOnEmpty, len(logs), tt.want)
+			}
+		}
+		if calls != tt.retryOnEmpty+1 {
+			t.Errorf("-retry-on-empty %d: %d queries, want %d and the second request from the cache", tt.retryOnEmpty, calls, tt.retryOnEmpty+1)
+		}
+	}
+}
+
+func TestRangeCacheCollectsInBlockOrder(t *testing.T) {
+	query := scanConfig{}.filterQuery()
+	node := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+		var logs []types.Log
+		for block := q.FromBlock.Uint64(); block <= q.ToBlock.Uint64(); block += 5 {
+			logs = append(logs, testLog(transferTopic, testAlice, testBob, 1, block, 0))
+		}
+		return logs, nil
+	})
+	cache := newRangeCache(node, query, 0, func(ctx context.Context) (uint64, error) { return 1000, nil })
+	// Filled out of order, the last request spanning the gap between the others
+	for _, r := range []blockRange{{50, 59}, {10, 19}, {30, 39}, {0, 70}} {
+		if _, err := cache.FilterLogs(context.Background(), rangeQuery(query, r.From, r.To)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logs := cache.collect(12, 55)
+	var blocks []uint64
+	for _, vLog := range logs {
+		blocks = append(blocks, vLog.BlockNumber)
+	}
+	want := []uint64{15, 20, 25, 30, 35, 40, 45, 50, 55}
+	if !slices.Equal(blocks, want) {
+		t.Errorf("collect(12, 55) = blocks %v, want %v", blocks, want)
+	}
+	if status := cache.Status(); len(status.Ranges) != 1 || status.Ranges[0] != (blockRange{0, 70}) {
+		t.Errorf("covered ranges = %v, want 0-70", status.Ranges)
+	}
+}
+
+func TestServerCacheRetriesEmptyRangesOnce(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		safe  uint64
+		calls int // for two requests of blocks 10-20
+	}{
+		{"cached", 1000, 3},
+		{"recent", 5, 6},
+	} {
+		calls := 0
+		node := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+			calls++
+			return nil, nil
+		})
+		s := &transferServer{logs: node, cfg: scanConfig{ChunkSize: 100, RetryOnEmpty: 2}}
+		s.useCache(func(ctx context.Context) (uint64, error) { return tt.safe, nil })
+		for range 2 {
+			cfg := s.cfg
+			cfg.StartBlock, cfg.EndBlock = 10, 20
+			if _, err := getUSDCTransfers(context.Background(), s.logs, cfg, &collectSink{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: %d queries for two empty requests with -retry-on-empty 2, want %d", tt.name, calls, tt.calls)
+		}
+	}
+}
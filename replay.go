@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// rawLogWriter streams logs to a file as a json array of eth_getLogs log
+// objects, one per line, so large scans don't keep every log in memory. The
+// array is only terminated by Close.
+type rawLogWriter struct {
+	file  *fileWriter
+	count int
+}
+
+func newRawLogWriter(path string) (*rawLogWriter, error) {
+	file, err := createFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.WriteString("["); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &rawLogWriter{file: file}, nil
+}
+
+// Write appends logs to the array
+func (w *rawLogWriter) Write(logs []types.Log) error {
+	for _, vLog := range logs {
+		data, err := json.Marshal(vLog)
+		if err != nil {
+			return err
+		}
+		sep := ",\n"
+		if w.count == 0 {
+			sep = "\n"
+		}
+		w.file.WriteString(sep)
+		if _, err := w.file.Write(data); err != nil {
+			return fmt.Errorf("Failed to save raw logs: %v", err)
+		}
+		w.count++
+	}
+	return nil
+}
+
+func (w *rawLogWriter) Close() error {
+	w.file.WriteString("\n]\n")
+	return w.file.Close()
+}
+
+// replayLogs decodes logs saved with -save-raw-logs without any RPC. Logs
+// outside the block range of cfg, of other contracts than cfg.Token if set
+// and, unless cfg.WithApprovals is set, Approval logs are skipped. cfg.Reverse
+// and cfg.MaxResults apply as in a scan.
+func replayLogs(path string, cfg scanConfig, sink Sink) (*Summary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var logs []types.Log
+	if err := json.Unmarshal(data, &logs); err != nil {
+		return nil, fmt.Errorf("Failed to parse raw logs in %s: %v", path, err)
+	}
+
+	var selected []types.Log
+	for _, vLog := range logs {
+		if vLog.BlockNumber < cfg.StartBlock || vLog.BlockNumber > cfg.EndBlock {
+			continue
+		}
+		if cfg.Token != (common.Address{}) && vLog.Address != cfg.Token {
+			continue
+		}
+		if !cfg.WithApprovals && len(vLog.Topics) > 0 && vLog.Topics[0] == approvalTopic {
+			continue
+		}
+		selected = append(selected, vLog)
+	}
+
+	if cfg.Reverse {
+		selected = newestFirst(selected)
+	}
+
+	summary := NewSummary()
+	if err := processLogs(selected, cfg, sink, summary); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(infoOut, "Replayed %d of %d records from %s\n", len(selected), len(logs), path)
+	summary.Finish()
+	return summary, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// revertReason extracts the revert reason of a failed eth_call. Nodes return the
+// revert payload as the data of the JSON-RPC error; ok is false when err carries
+// none, which some nodes and most proxies of public endpoints never return.
+func revertReason(err error) (reason string, ok bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return "", false
+	}
+	s, isString := dataErr.ErrorData().(string)
+	if !isString {
+		return "", false
+	}
+	data, decodeErr := hexutil.Decode(s)
+	if decodeErr != nil {
+		return "", false
+	}
+	return revertDataReason(data)
+}
+
+// revertDataReason decodes an Error(string) or Panic(uint256) revert payload.
+// Custom errors can't be decoded without their ABI and are returned as hex.
+func revertDataReason(data []byte) (string, bool) {
+	if len(data) == 0 {
+		return "", false
+	}
+	reason, err := abi.UnpackRevert(data)
+	if err != nil {
+		return hexutil.Encode(data), true
+	}
+	return reason, true
+}
+
+// withRevertReason adds the decoded revert reason to err, if the node returned one
+func withRevertReason(err error) error {
+	if reason, ok := revertReason(err); ok {
+		return fmt.Errorf("%v (revert reason: %q)", err, reason)
+	}
+	return err
+}
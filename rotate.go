@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// rotatingWriter writes to numbered files, starting a new one when the next
+// write would grow the current file past limit bytes. Rotation only happens
+// between writes, so a record is never split across files. header is written
+// at the top of every file.
+type rotatingWriter struct {
+	path    string
+	limit   int64
+	header  []byte
+	index   int
+	written int64
+	file    *fileWriter
+}
+
+func newRotatingWriter(path string, limit int64, header []byte) *rotatingWriter {
+	return &rotatingWriter{path: path, limit: limit, header: header}
+}
+
+func (r *rotatingWriter) Write(p []byte) (int, error) {
+	full := r.written > int64(len(r.header)) && r.written+int64(len(p)) > r.limit
+	if r.file == nil || full {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.written += int64(n)
+	return n, err
+}
+
+// rotate closes the current file and opens the next numbered one
+func (r *rotatingWriter) rotate() error {
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.file = nil
+	}
+
+	r.index++
+	file, err := createFile(rotatedName(r.path, r.index))
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.written = 0
+
+	n, err := r.file.Write(r.header)
+	r.written += int64(n)
+	return err
+}
+
+func (r *rotatingWriter) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// rotatedName inserts the file number before the extensions,
+// e.g. out/transfers.ndjson.gz -> out/transfers.0001.ndjson.gz
+func rotatedName(path string, index int) string {
+	dir, base := filepath.Split(path)
+	name, ext := base, ""
+	if i := strings.Index(base, "."); i > 0 {
+		name, ext = base[:i], base[i:]
+	}
+	return fmt.Sprintf("%s%s.%04d%s", dir, name, index, ext)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// logFilterer is implemented by *ethclient.Client and *endpointPool
+type logFilterer interface {
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// Weight of the newest sample in the latency and error rate averages
+const SCORE_EWMA_ALPHA = 0.3
+
+// How often the endpoint ranking is recomputed
+const RERANK_INTERVAL = 30 * time.Second
+
+// endpoint is one RPC endpoint with its health statistics
+type endpoint struct {
+	URL    string
+	client *ethclient.Client
+
+	latency   time.Duration // EWMA of successful call latency
+	errorRate float64       // EWMA of failures, 0 to 1
+	calls     int
+	errors    int
+	nextCall  time.Time // earliest start of the next call under the rate limit
+}
+
+// score ranks endpoints, lower is better. Failures weigh much more than latency
+// so a fast but failing endpoint drops behind slower healthy ones.
+func (e *endpoint) score() float64 {
+	latency := e.latency
+	if latency == 0 && e.errors > 0 {
+		// Never succeeded: rank behind every endpoint that did
+		latency = time.Hour
+	}
+	return float64(latency) * (1 + 10*e.errorRate)
+}
+
+// endpointPool spreads log queries over several endpoints. It tracks an EWMA
+// of latency and errors per endpoint, prefers the best scored one and fails
+// over to the others in rank order when a call fails.
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	ranked    []*endpoint
+	rankedAt  time.Time
+	logScores bool
+	// Minimum time between the starts of two calls to the same endpoint
+	callInterval time.Duration
+}
+
+// newEndpointPool dials every endpoint. Until scores are known they are tried in the given order.
+func newEndpointPool(urls []string, logScores bool) (*endpointPool, error) {
+	pool := &endpointPool{logScores: logScores}
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		client, err := ethclient.Dial(url)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to connect to %s: %v", url, err)
+		}
+		pool.endpoints = append(pool.endpoints, &endpoint{URL: url, client: client})
+	}
+	if len(pool.endpoints) == 0 {
+		return nil, fmt.Errorf("No RPC endpoint configured")
+	}
+	pool.ranked = append([]*endpoint(nil), pool.endpoints...)
+	pool.rankedAt = time.Now()
+	return pool, nil
+}
+
+// Primary returns the client of the first configured endpoint, used for everything but log queries
+func (p *endpointPool) Primary() *ethclient.Client {
+	return p.endpoints[0].client
+}
+
+// FilterLogs runs the query on the best ranked endpoint, failing over to the next ones on error
+func (p *endpointPool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var lastErr error
+	for _, e := range p.ranking() {
+		if err := p.throttle(ctx, e); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		logs, err := e.client.FilterLogs(ctx, q)
+		p.record(e, time.Since(start), err)
+		if err == nil {
+			return logs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if len(p.endpoints) > 1 {
+			log.Printf("RPC endpoint %s failed, trying the next one: %v", e.URL, err)
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// SetRateLimit limits the calls to each endpoint to perSecond; zero means unlimited
+func (p *endpointPool) SetRateLimit(perSecond float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.callInterval = 0
+	if perSecond > 0 {
+		p.callInterval = time.Duration(float64(time.Second) / perSecond)
+	}
+}
+
+// throttle waits until e may be called again under the rate limit
+func (p *endpointPool) throttle(ctx context.Context, e *endpoint) error {
+	p.mu.Lock()
+	at := time.Now()
+	if e.nextCall.After(at) {
+		at = e.nextCall
+	}
+	e.nextCall = at.Add(p.callInterval)
+	p.mu.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// record updates the statistics of e after a call
+func (p *endpointPool) record(e *endpoint, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.calls++
+	failed := 0.0
+	if err != nil {
+		e.errors++
+		failed = 1
+	} else if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(SCORE_EWMA_ALPHA*float64(latency) + (1-SCORE_EWMA_ALPHA)*float64(e.latency))
+	}
+	e.errorRate = SCORE_EWMA_ALPHA*failed + (1-SCORE_EWMA_ALPHA)*e.errorRate
+}
+
+// ranking returns the endpoints in preference order, re-ranking them every RERANK_INTERVAL
+func (p *endpointPool) ranking() []*endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.rankedAt) >= RERANK_INTERVAL {
+		sort.SliceStable(p.ranked, func(i, j int) bool { return p.ranked[i].score() < p.ranked[j].score() })
+		p.rankedAt = time.Now()
+		if p.logScores && len(p.ranked) > 1 {
+			log.Printf("RPC endpoint scores: %s", p.scoresLocked())
+		}
+	}
+	return append([]*endpoint(nil), p.ranked...)
+}
+
+// Scores describes the ranking and statistics of every endpoint
+func (p *endpointPool) Scores() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.scoresLocked()
+}
+
+func (p *endpointPool) scoresLocked() string {
+	parts := make([]string, len(p.ranked))
+	for i, e := range p.ranked {
+		parts[i] = fmt.Sprintf("#%d %s latency=%s errors=%d/%d error_rate=%.2f",
+			i+1, e.URL, e.latency.Round(time.Millisecond), e.errors, e.calls, e.errorRate)
+	}
+	return strings.Join(parts, "; ")
+}
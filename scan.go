@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scanConfig describes the token, block range and events of a scan
+type scanConfig struct {
+	Token         common.Address
+	StartBlock    uint64
+	EndBlock      uint64
+	ChunkSize     uint64
+	WithApprovals bool
+	RetryOnEmpty  int
+	// Skip logs that fail to decode instead of aborting
+	SkipDecodeErrors bool
+	// Stream the raw logs as a json array to this file, for -replay
+	RawLogsPath string
+	// Client-side filters; a record is kept if every filter accepts it
+	Filters []transferFilter
+	// Fetch chunks concurrently from every endpoint of an endpointPool
+	Parallel bool
+	// Fail on logs without the 3 topics of a Transfer or Approval instead of skipping them
+	StrictTopics bool
+	// Scan the chunks from EndBlock downwards and emit the records newest first
+	Reverse bool
+	// Stop after this many records; zero means no limit
+	MaxResults int
+	// Don't print the records found, for the scans of each REST API request
+	Quiet bool
+}
+
+// limitReached reports whether summary holds cfg.MaxResults records
+func (cfg scanConfig) limitReached(summary *Summary) bool {
+	return cfg.MaxResults > 0 && summary.Count+summary.Approvals >= cfg.MaxResults
+}
+
+// errLimitReached stops a scan once cfg.MaxResults records were written
+var errLimitReached = errors.New("-max-results reached")
+
+// filterQuery builds the log filter of a scan, without a block range.
+// Transfer and Approval are fetched with one FilterLogs call by putting
+// their topics into an OR set.
+func (cfg scanConfig) filterQuery() ethereum.FilterQuery {
+	topics := []common.Hash{transferTopic}
+	if cfg.WithApprovals {
+		topics = append(topics, approvalTopic)
+	}
+	return ethereum.FilterQuery{
+		Addresses: []common.Address{cfg.Token},
+		Topics:    [][]common.Hash{topics},
+	}
+}
+
+// forEachChunk calls fn for consecutive block ranges of at most size blocks covering [start, end]
+func forEachChunk(start uint64, end uint64, size uint64, fn func(from uint64, to uint64) error) error {
+	for from := start; from <= end; from += size {
+		to := end
+		if end-from >= size {
+			to = from + size - 1
+		}
+		if err := fn(from, to); err != nil {
+			return err
+		}
+		if to == end {
+			break
+		}
+	}
+	return nil
+}
+
+// forEachChunkReverse is forEachChunk from the high end of [start, end] downwards
+func forEachChunkReverse(start uint64, end uint64, size uint64, fn func(from uint64, to uint64) error) error {
+	for to := end; to >= start; to -= size {
+		from := start
+		if to-start >= size {
+			from = to - size + 1
+		}
+		if err := fn(from, to); err != nil {
+			return err
+		}
+		if from == start {
+			break
+		}
+	}
+	return nil
+}
+
+// newestFirst sorts logs by descending block and log index, dropping
+// duplicates a provider may return within one response
+func newestFirst(logs []types.Log) []types.Log {
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber > logs[j].BlockNumber
+		}
+		return logs[i].Index > logs[j].Index
+	})
+	unique := logs[:0]
+	for _, vLog := range logs {
+		if n := len(unique); n > 0 && vLog.BlockNumber == unique[n-1].BlockNumber && vLog.Index == unique[n-1].Index {
+			continue
+		}
+		unique = append(unique, vLog)
+	}
+	return unique
+}
+
+// fetchChunk fetches the logs of one block range. Some load-balanced providers
+// intermittently return no logs for ranges that have them, so an empty result
+// is retried up to retryOnEmpty times before it is accepted.
+func fetchChunk(ctx context.Context, client logFilterer, query ethereum.FilterQuery, from uint64, to uint64, retryOnEmpty int) (logs []types.Log, err error) {
+	ctx, span := tracer.Start(ctx, "FilterLogs", trace.WithAttributes(
+		attribute.Int64("block.from", int64(from)),
+		attribute.Int64("block.to", int64(to)),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("logs.count", len(logs)))
+		endSpan(span, err)
+	}()
+
+	query.FromBlock = new(big.Int).SetUint64(from)
+	query.ToBlock = new(big.Int).SetUint64(to)
+
+	logs, err = client.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, rpcFailure(fmt.Errorf("Failed to filter logs in blocks %d-%d: %v", from, to, err))
+	}
+	for attempt := 1; len(logs) == 0 && attempt <= retryOnEmpty; attempt++ {
+		span.SetAttributes(attribute.Int("retries", attempt))
+		logs, err = client.FilterLogs(ctx, query)
+		if err != nil {
+			return nil, rpcFailure(fmt.Errorf("Failed to filter logs in blocks %d-%d: %v", from, to, err))
+		}
+		if len(logs) > 0 {
+			log.Printf("Retry %d of empty blocks %d-%d returned %d logs", attempt, from, to, len(logs))
+		}
+	}
+	return logs, nil
+}
+
+// getUSDCTransfers queries the token's Transfer logs, plus Approval logs if configured,
+// chunk by chunk, writes the decoded records to sink and returns their summary
+func getUSDCTransfers(ctx context.Context, client logFilterer, cfg scanConfig, sink Sink) (summary *Summary, err error) {
+	ctx, span := tracer.Start(ctx, "scan", trace.WithAttributes(
+		attribute.Int64("block.from", int64(cfg.StartBlock)),
+		attribute.Int64("block.to", int64(cfg.EndBlock)),
+	))
+	defer func() {
+		if summary != nil {
+			span.SetAttributes(attribute.Int("transfers.count", summary.Count))
+		}
+		endSpan(span, err)
+	}()
+
+	query := cfg.filterQuery()
+	found := 0
+	summary = NewSummary()
+
+	var raw *rawLogWriter
+	if cfg.RawLogsPath != "" {
+		raw, err = newRawLogWriter(cfg.RawLogsPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	handle := func(logs []types.Log) error {
+		found += len(logs)
+		if raw != nil {
+			if err := raw.Write(logs); err != nil {
+				return err
+			}
+		}
+		if err := processLogs(logs, cfg, sink, summary); err != nil {
+			return err
+		}
+		if cfg.limitReached(summary) {
+			return errLimitReached
+		}
+		return nil
+	}
+	if pool, ok := client.(*endpointPool); ok && cfg.Parallel && len(pool.endpoints) > 1 {
+		err = pool.forEachChunkParallel(ctx, query, cfg, handle)
+	} else {
+		chunks := forEachChunk
+		if cfg.Reverse {
+			chunks = forEachChunkReverse
+		}
+		err = chunks(cfg.StartBlock, cfg.EndBlock, cfg.ChunkSize, func(from uint64, to uint64) error {
+			logs, err := fetchChunk(ctx, client, query, from, to, cfg.RetryOnEmpty)
+			if err != nil {
+				return err
+			}
+			if cfg.Reverse {
+				logs = newestFirst(logs)
+			}
+			return handle(logs)
+		})
+	}
+	if err == errLimitReached {
+		fmt.Fprintf(infoOut, "Stopped after -max-results %d records\n", cfg.MaxResults)
+		err = nil
+	}
+	if raw != nil {
+		if closeErr := raw.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.Quiet {
+		fmt.Fprintf(infoOut, "Found %d transfer records between blocks %d and %d\n", found, cfg.StartBlock, cfg.EndBlock)
+	}
+	summary.Finish()
+	return summary, nil
+}
+
+// processLogs decodes logs, writes the records passing cfg.Filters to sink
+// and adds them to summary. With cfg.SkipDecodeErrors a log that fails to
+// decode is counted in the summary and skipped with a warning, otherwise it
+// aborts. Logs with unexpected topics are skipped silently unless cfg.StrictTopics.
+// Logs past cfg.MaxResults records are ignored.
+func processLogs(logs []types.Log, cfg scanConfig, sink Sink, summary *Summary) error {
+next:
+	for _, vLog := range logs {
+		if cfg.limitReached(summary) {
+			return nil
+		}
+		t, err := decodeLog(vLog)
+		if err == errUnexpectedTopics && cfg.StrictTopics {
+			return fmt.Errorf("Log %d of tx %s in block %d has %d topics, expected 3 with a Transfer or Approval topic first", vLog.Index, vLog.TxHash.Hex(), vLog.BlockNumber, len(vLog.Topics))
+		}
+		if err == errUnexpectedTopics {
+			continue
+		}
+		if err != nil && cfg.SkipDecodeErrors {
+			log.Printf("WARNING: skipping log: %v", err)
+			summary.Skipped++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, filter := range cfg.Filters {
+			keep, err := filter.Keep(t)
+			if err != nil {
+				return fmt.Errorf("Failed to apply %s to tx %s: %w", filter.Name, t.TxHash.Hex(), err)
+			}
+			if !keep {
+				summary.Filtered[filter.Name]++
+				continue next
+			}
+		}
+		err = sink.Write(t)
+		if errors.Is(err, ErrSkipTransfer) {
+			summary.Filtered[HANDLER_FILTER_NAME]++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to write transfer: %w", err)
+		}
+		summary.Add(t)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestProcessLogsSkipsCorruptLog(t *testing.T) {
+	corrupt := testLog(transferTopic, testAlice, testBob, 1, 11, 0)
+	corrupt.Data = corrupt.Data[:31]
+	logs := []types.Log{
+		testLog(transferTopic, testAlice, testBob, 1_000_000, 10, 0),
+		corrupt,
+		testLog(transferTopic, testBob, testAlice, 2_000_000, 12, 0),
+	}
+
+	var records collectSink
+	summary := NewSummary()
+	if err := processLogs(logs, scanConfig{SkipDecodeErrors: true}, &records, summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].BlockNumber != 10 || records[1].BlockNumber != 12 {
+		t.Errorf("got records %+v, want the logs of blocks 10 and 12", records)
+	}
+	if summary.Skipped != 1 || summary.Count != 2 {
+		t.Errorf("skipped %d and counted %d, want 1 and 2", summary.Skipped, summary.Count)
+	}
+
+	records = nil
+	if err := processLogs(logs, scanConfig{}, &records, NewSummary()); err == nil {
+		t.Error("strict decoding accepted the corrupt log")
+	}
+	if len(records) != 1 {
+		t.Errorf("strict decoding wrote %d records before failing, want 1", len(records))
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// How long the server reuses the head block number between requests
+const HEAD_CACHE_TTL = 2 * time.Second
+
+// headCache resolves the chain head for the server, at most once per HEAD_CACHE_TTL
+type headCache struct {
+	client *ethclient.Client
+
+	mu        sync.Mutex
+	head      uint64
+	fetchedAt time.Time
+}
+
+func (h *headCache) Head(ctx context.Context) (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.fetchedAt.IsZero() && time.Since(h.fetchedAt) < HEAD_CACHE_TTL {
+		return h.head, nil
+	}
+	head, err := h.client.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	h.head, h.fetchedAt = head, time.Now()
+	return head, nil
+}
+
+// collectSink keeps the records of a scan in memory
+type collectSink []Transfer
+
+func (c *collectSink) Write(t Transfer) error {
+	*c = append(*c, t)
+	return nil
+}
+
+func (c *collectSink) Close() error {
+	return nil
+}
+
+// transferServer serves transfer scans over HTTP
+type transferServer struct {
+	head     *headCache
+	logs     logFilterer
+	cfg      scanConfig // template; the block range is set per request
+	opts     outputOptions
+	maxRange uint64
+	watch    watchConfig // polling of /transfers/stream
+	hub      *transferHub
+	cache    *rangeCache // set with -serve-cache, also in logs
+}
+
+// useCache puts a rangeCache in front of the server's logs. The cache does
+// the -retry-on-empty retries, so the scans reading through it don't.
+func (s *transferServer) useCache(safe func(ctx context.Context) (uint64, error)) {
+	s.cache = newRangeCache(s.logs, s.cfg.filterQuery(), s.cfg.RetryOnEmpty, safe)
+	s.logs = s.cache
+	s.cfg.RetryOnEmpty = 0
+}
+
+// transfersResponse is the body of GET /transfers
+type transfersResponse struct {
+	Head             uint64         `json:"head"`
+	From             uint64         `json:"from"`
+	To               uint64         `json:"to"`
+	MinConfirmations uint64         `json:"min_confirmations"`
+	Transfers        []jsonTransfer `json:"transfers"`
+}
+
+// serveTransfers handles GET /transfers?from=&to=&min_confirmations=. A block
+// at the head has 1 confirmation, so min_confirmations=N limits to to
+// head-N+1; the default of 0 includes the head. from defaults to 99 blocks
+// before to, to to the newest allowed block.
+//
+// The response echoes the head and the range actually scanned; to is below
+// from when nothing in the requested range is confirmed enough yet.
+func (s *transferServer) serveTransfers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	params := make(map[string]uint64)
+	for _, name := range []string{"from", "to", "min_confirmations"} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s %q", name, value), http.StatusBadRequest)
+				return
+			}
+			params[name] = n
+		}
+	}
+
+	head, err := s.head.Head(r.Context())
+	if err != nil {
+		log.Printf("Failed to get the latest block number: %v", err)
+		http.Error(w, "Failed to get the latest block number", http.StatusBadGateway)
+		return
+	}
+
+	minConfirmations := params["min_confirmations"]
+	confirmed := head
+	if minConfirmations > 1 {
+		if minConfirmations-1 > head {
+			http.Error(w, fmt.Sprintf("No block has %d confirmations yet", minConfirmations), http.StatusBadRequest)
+			return
+		}
+		confirmed = head - (minConfirmations - 1)
+	}
+	to := confirmed
+	if n, ok := params["to"]; ok {
+		to = min(n, confirmed)
+	}
+	from := to - min(to, 99)
+	if n, ok := params["from"]; ok {
+		from = n
+	}
+	if n, ok := params["to"]; ok && from > n {
+		http.Error(w, fmt.Sprintf("from %d is after to %d", from, n), http.StatusBadRequest)
+		return
+	}
+	if from <= to && to-from >= s.maxRange {
+		http.Error(w, fmt.Sprintf("At most %d blocks per request", s.maxRange), http.StatusBadRequest)
+		return
+	}
+
+	// A range without enough confirmations yet is empty rather than an error,
+	// so clients can poll for it
+	var records collectSink
+	if from <= to {
+		cfg := s.cfg
+		cfg.StartBlock, cfg.EndBlock = from, to
+		cfg.Quiet = true
+		if _, err := getUSDCTransfers(r.Context(), s.logs, cfg, &records); err != nil {
+			log.Printf("Failed to query USDC transfer records: %v", err)
+			http.Error(w, "Failed to query transfers", http.StatusBadGateway)
+			return
+		}
+	}
+
+	resp := transfersResponse{
+		Head:             head,
+		From:             from,
+		To:               to,
+		MinConfirmations: minConfirmations,
+		Transfers:        make([]jsonTransfer, len(records)),
+	}
+	for i, t := range records {
+		resp.Transfers[i] = newJSONTransfer(t, s.opts.Decimals)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// serveCache handles GET /cache with the block ranges indexed by -serve-cache
+func (s *transferServer) serveCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.cache.Status()); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// serverTimeouts bound how long the REST API waits for slow clients
+type serverTimeouts struct {
+	Read  time.Duration // reading a whole request, headers included
+	Write time.Duration // from the end of the request headers to the end of the response
+	Idle  time.Duration // keep-alive connections between requests
+	// How long in-flight requests may drain after ctx is cancelled
+	Shutdown time.Duration
+}
+
+// serve runs the REST API on addr until it fails or ctx is cancelled, then
+// shuts down gracefully: in-flight requests get timeouts.Shutdown to finish
+// before the remaining connections are closed. The live stream is watched
+// until ctx is cancelled, which also ends the open event streams.
+func serve(ctx context.Context, addr string, s *transferServer, timeouts serverTimeouts) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return serveListener(ctx, ln, s, timeouts)
+}
+
+// serveListener is serve on a listener, which it closes
+func serveListener(ctx context.Context, ln net.Listener, s *transferServer, timeouts serverTimeouts) error {
+	s.hub = newTransferHub(func() { go s.watchHub(ctx) })
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transfers", s.serveTransfers)
+	mux.HandleFunc("/transfers/stream", s.serveStream)
+	if s.cache != nil {
+		mux.HandleFunc("/cache", s.serveCache)
+	}
+	server := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  timeouts.Read,
+		WriteTimeout: timeouts.Write,
+		IdleTimeout:  timeouts.Idle,
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down the REST API, draining requests for up to %s", timeouts.Shutdown)
+		drainCtx, cancel := context.WithTimeout(context.Background(), timeouts.Shutdown)
+		defer cancel()
+		err := server.Shutdown(drainCtx)
+		if err != nil {
+			server.Close()
+		}
+		stopped <- err
+	}()
+
+	log.Printf("Serving the REST API on http://%s/transfers", ln.Addr())
+	if err := server.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	if err := <-stopped; err != nil {
+		return fmt.Errorf("Failed to drain requests: %v", err)
+	}
+	return nil
+}
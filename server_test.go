@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestServerCutsOffSlowClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- serveListener(ctx, ln, &transferServer{}, serverTimeouts{Read: 100 * time.Millisecond, Write: time.Second, Idle: time.Second, Shutdown: time.Second})
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The headers never end
+	if _, err := io.WriteString(conn, "GET /transfers HTTP/1.1\r\nHost: test\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("the server didn't close the connection: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the slow client was cut off after %s, want about the 100ms read timeout", elapsed)
+	}
+
+	cancel()
+	if err := <-stopped; err != nil {
+		t.Errorf("serve = %v after the cancellation, want nil", err)
+	}
+}
+
+func TestServeTransfersKeepsStdoutQuiet(t *testing.T) {
+	var out bytes.Buffer
+	infoOut = &out
+	defer func() { infoOut = os.Stdout }()
+
+	node := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+		return []types.Log{testLog(transferTopic, testAlice, testBob, 1_000_000, 15, 0)}, nil
+	})
+	s := &transferServer{
+		head:     &headCache{head: 50, fetchedAt: time.Now()},
+		logs:     node,
+		cfg:      scanConfig{ChunkSize: 100},
+		opts:     outputOptions{Decimals: 6},
+		maxRange: 100,
+	}
+	w := httptest.NewRecorder()
+	s.serveTransfers(w, httptest.NewRequest(http.MethodGet, "/transfers?from=10&to=20", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"block":15`) {
+		t.Fatalf("GET /transfers = %d %s, want the record of block 15", w.Code, w.Body)
+	}
+	if out.Len() > 0 {
+		t.Errorf("a request printed %q", out.String())
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sinkSpec is a parsed -sink value of the form format[:path]
+type sinkSpec struct {
+	Format string
+	Path   string
+}
+
+func (s sinkSpec) String() string {
+	if s.Path == "" {
+		return s.Format + ":stdout"
+	}
+	return s.Format + ":" + s.Path
+}
+
+func parseSinkSpec(spec string) (sinkSpec, error) {
+	format, path, _ := strings.Cut(spec, ":")
+	if !validFormat(format) {
+		return sinkSpec{}, fmt.Errorf("Unknown output format %q in sink %q", format, spec)
+	}
+	return sinkSpec{Format: format, Path: path}, nil
+}
+
+// multiSink fans each transfer out to all of its sinks. A failing sink doesn't
+// stop the others from receiving the transfer; the errors are joined.
+type multiSink []Sink
+
+func (m multiSink) Write(t Transfer) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// openSinks opens all sinks, combining them into a multiSink if there are several.
+// With a buffer size each sink is written from its own goroutine.
+func openSinks(specs []sinkSpec, rotateSize int64, opts outputOptions, buffer bufferConfig) (Sink, error) {
+	var sinks multiSink
+	for _, spec := range specs {
+		sink, err := openSink(spec.Format, spec.Path, rotateSize, opts)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		if buffer.Size > 0 {
+			sink = newBufferedSink(spec.String(), sink, buffer)
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// holderSet is a sink collecting every address that sent or received tokens
+type holderSet struct {
+	seen      map[common.Address]struct{}
+	addresses []common.Address
+}
+
+func newHolderSet() *holderSet {
+	return &holderSet{seen: make(map[common.Address]struct{})}
+}
+
+func (h *holderSet) Write(t Transfer) error {
+	if t.Event != EventTransfer {
+		return nil
+	}
+	for _, address := range []common.Address{t.From, t.To} {
+		if address == (common.Address{}) {
+			continue
+		}
+		if _, ok := h.seen[address]; !ok {
+			h.seen[address] = struct{}{}
+			h.addresses = append(h.addresses, address)
+		}
+	}
+	return nil
+}
+
+func (h *holderSet) Close() error {
+	return nil
+}
+
+// readAddresses reads one address per line; blank lines and # comments are ignored
+func readAddresses(path string) ([]common.Address, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var addresses []common.Address
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if !common.IsHexAddress(text) {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", path, line, text)
+		}
+		addresses = append(addresses, common.HexToAddress(text))
+	}
+	return addresses, scanner.Err()
+}
+
+// snapshotConfig controls a balance snapshot
+type snapshotConfig struct {
+	// Addresses to query; discovered with a transfer scan of Scan when empty
+	Addresses   []common.Address
+	Scan        scanConfig
+	Block       uint64
+	BatchSize   int
+	Concurrency int
+	// Add a pct column of each balance relative to totalSupply() at Block
+	WithPct bool
+}
+
+// Fractional digits of the snapshot pct column
+const SNAPSHOT_PCT_DIGITS = 6
+
+// percentOf formats amount as a percentage of total with SNAPSHOT_PCT_DIGITS
+// fractional digits, computed exactly before rounding
+func percentOf(amount *big.Int, total *big.Int) string {
+	pct := new(big.Rat).SetFrac(new(big.Int).Mul(amount, big.NewInt(100)), total)
+	return pct.FloatString(SNAPSHOT_PCT_DIGITS)
+}
+
+// balanceSnapshot writes the {address, balance} of every address at cfg.Block,
+// largest first, and their {pct} of the total supply if cfg.WithPct is set
+func balanceSnapshot(ctx context.Context, client *ethclient.Client, logs logFilterer, cfg snapshotConfig, opts outputOptions, w io.Writer, format string) error {
+	addresses := cfg.Addresses
+	if len(addresses) == 0 {
+		holders := newHolderSet()
+		if _, err := getUSDCTransfers(ctx, logs, cfg.Scan, holders); err != nil {
+			return err
+		}
+		addresses = holders.addresses
+	}
+	fmt.Fprintf(infoOut, "Querying %d balances at block %d\n", len(addresses), cfg.Block)
+
+	balances, err := balancesAt(ctx, client, cfg.Scan.Token, addresses, new(big.Int).SetUint64(cfg.Block), cfg.BatchSize, cfg.Concurrency)
+	if err != nil {
+		return err
+	}
+
+	var supply *big.Int
+	if cfg.WithPct {
+		usdc, err := NewUSDC(cfg.Scan.Token, client)
+		if err != nil {
+			return err
+		}
+		supply, err = usdc.TotalSupply(&bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(cfg.Block)})
+		if err != nil {
+			return rpcFailure(fmt.Errorf("Failed to get total supply at block %d: %v", cfg.Block, err))
+		}
+		if supply.Sign() == 0 {
+			return fmt.Errorf("Total supply at block %d is zero", cfg.Block)
+		}
+	}
+
+	order := make([]int, len(addresses))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return balances[order[i]].Cmp(balances[order[j]]) > 0 })
+
+	columns := []string{"address", "balance"}
+	if cfg.WithPct {
+		columns = append(columns, "pct")
+	}
+	rows := make([][]interface{}, len(order))
+	for i, k := range order {
+		rows[i] = []interface{}{addresses[k].Hex(), opts.reportAmount(format, balances[k])}
+		if cfg.WithPct {
+			rows[i] = append(rows[i], percentOf(balances[k], supply))
+		}
+	}
+	return writeTable(w, format, columns, rows)
+}
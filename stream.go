@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How often an idle event stream gets a comment line, so proxies keep it open
+const SSE_HEARTBEAT_INTERVAL = 15 * time.Second
+
+// Events buffered per stream client; a client that falls further behind is disconnected
+const SSE_CLIENT_BUFFER = 1000
+
+// transferHub is a sink that fans live transfers out to the connected stream
+// clients. The watch loop feeding it is only started with the first client,
+// and started again by the next client after it stopped.
+type transferHub struct {
+	start func()
+
+	mu      sync.Mutex
+	running bool
+	subs    map[chan Transfer]struct{}
+}
+
+func newTransferHub(start func()) *transferHub {
+	return &transferHub{start: start, subs: make(map[chan Transfer]struct{})}
+}
+
+// Subscribe returns a channel of new transfers; it is closed if the client can't keep up
+func (h *transferHub) Subscribe() chan Transfer {
+	ch := make(chan Transfer, SSE_CLIENT_BUFFER)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.running {
+		h.running = true
+		h.start()
+	}
+	h.subs[ch] = struct{}{}
+	return ch
+}
+
+func (h *transferHub) Unsubscribe(ch chan Transfer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+func (h *transferHub) Write(t Transfer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- t:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+	return nil
+}
+
+// stopped disconnects the clients once the watch loop exited, so the next
+// client starts it again
+func (h *transferHub) stopped() {
+	h.Close()
+	h.mu.Lock()
+	h.running = false
+	h.mu.Unlock()
+}
+
+func (h *transferHub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+	return nil
+}
+
+// watchHub starts watch mode from the block after the current head, feeding hub
+func (s *transferServer) watchHub(ctx context.Context) {
+	head, err := s.head.Head(ctx)
+	if err != nil {
+		log.Printf("Failed to start the transfer stream: %v", err)
+		s.hub.stopped()
+		return
+	}
+	cfg := s.watch
+	cfg.Scan = s.cfg
+	cfg.Scan.StartBlock = head + 1
+	log.Printf("Streaming transfers from block %d", head+1)
+	if _, err := watchTransfers(ctx, s.head.client, s.logs, cfg, s.hub); err != nil {
+		log.Printf("Transfer stream stopped: %v", err)
+	}
+	s.hub.stopped()
+}
+
+// serveStream handles GET /transfers/stream, pushing each new transfer as a
+// Server-Sent Event with the ndjson record as data. The subscription ends
+// when the client disconnects and its request context is cancelled.
+func (s *transferServer) serveStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The server's write timeout would cut the stream; heartbeats detect dead clients instead
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to lift the write timeout of an event stream: %v", err)
+	}
+
+	ch := s.hub.Subscribe()
+	defer s.hub.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(SSE_HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case t, ok := <-ch:
+			if !ok {
+				// Fell behind or the stream stopped; the client reconnects
+				return
+			}
+			data, err := json.Marshal(newJSONTransfer(t, s.opts.Decimals))
+			if err != nil {
+				log.Printf("Failed to encode transfer: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: transfer\nid: %d-%d\ndata: %s\n\n", t.BlockNumber, t.LogIndex, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestTransferHubRestarts(t *testing.T) {
+	starts := 0
+	hub := newTransferHub(func() { starts++ })
+	first := hub.Subscribe()
+	hub.Subscribe()
+	if starts != 1 {
+		t.Fatalf("started %d watchers for two clients, want 1", starts)
+	}
+
+	// The watcher exits, e.g. after an RPC failure
+	hub.stopped()
+	if _, ok := <-first; ok {
+		t.Fatal("the client stayed subscribed after the watcher stopped")
+	}
+	ch := hub.Subscribe()
+	if starts != 2 {
+		t.Fatalf("started %d watchers, want a new one for the next client", starts)
+	}
+	if err := hub.Write(Transfer{BlockNumber: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-ch; got.BlockNumber != 10 {
+		t.Errorf("got block %d, want 10", got.BlockNumber)
+	}
+}
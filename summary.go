@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+)
+
+// Summary aggregates the Transfer events of a scan. Approvals are counted
+// separately and don't contribute to the volume.
+type Summary struct {
+	Count         int
+	Approvals     int
+	Skipped       int
+	SelfTransfers int
+	Filtered      map[string]int // records dropped by client-side filters, by filter
+	Dropped       map[string]int // records dropped by full sink buffers, by sink
+	Total         *big.Int
+	AverageAmount *big.Int
+	MedianAmount  *big.Int
+
+	median  bool // keep amounts for MedianAmount
+	amounts []*big.Int
+}
+
+// NewSummary returns the summary of a bounded scan, with a median
+func NewSummary() *Summary {
+	return &Summary{Total: new(big.Int), Filtered: make(map[string]int), median: true}
+}
+
+// NewRunningSummary returns a summary without a median, for -watch and -full,
+// which would otherwise keep every amount of an unbounded history in memory
+func NewRunningSummary() *Summary {
+	return &Summary{Total: new(big.Int), Filtered: make(map[string]int)}
+}
+
+// Add records a decoded record
+func (s *Summary) Add(t Transfer) {
+	if t.Event == EventApproval {
+		s.Approvals++
+		return
+	}
+	s.Count++
+	if isSelfTransfer(t) {
+		s.SelfTransfers++
+	}
+	s.Total.Add(s.Total, t.Amount)
+	if s.median {
+		s.amounts = append(s.amounts, t.Amount)
+	}
+}
+
+// Finish computes the average and median amounts; both stay nil without
+// transfers, and the median without amounts kept
+func (s *Summary) Finish() {
+	if s.Count == 0 {
+		return
+	}
+	s.AverageAmount = new(big.Int).Quo(s.Total, big.NewInt(int64(s.Count)))
+	if !s.median {
+		return
+	}
+
+	sorted := make([]*big.Int, len(s.amounts))
+	copy(sorted, s.amounts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Cmp(sorted[j]) < 0 })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		s.MedianAmount = new(big.Int).Set(sorted[mid])
+	} else {
+		s.MedianAmount = new(big.Int).Add(sorted[mid-1], sorted[mid])
+		s.MedianAmount.Quo(s.MedianAmount, big.NewInt(2))
+	}
+}
+
+// printSummary prints a finished summary
+func printSummary(w io.Writer, s *Summary, opts outputOptions) {
+	fmt.Fprintf(w, "Summary: %d transfers, volume %s %s", s.Count, opts.textAmount(s.Total), opts.Symbol)
+	if s.Count > 0 {
+		fmt.Fprintf(w, ", average %s %s", opts.textAmount(s.AverageAmount), opts.Symbol)
+	}
+	if s.MedianAmount != nil {
+		fmt.Fprintf(w, ", median %s %s", opts.textAmount(s.MedianAmount), opts.Symbol)
+	}
+	if s.Approvals > 0 {
+		fmt.Fprintf(w, ", %d approvals", s.Approvals)
+	}
+	if s.SelfTransfers > 0 {
+		fmt.Fprintf(w, ", %d self-transfers", s.SelfTransfers)
+	}
+	if s.Skipped > 0 {
+		fmt.Fprintf(w, ", %d undecodable logs skipped", s.Skipped)
+	}
+	for _, name := range sortedKeys(s.Filtered) {
+		fmt.Fprintf(w, ", %d records excluded by %s", s.Filtered[name], name)
+	}
+	for _, name := range sortedKeys(s.Dropped) {
+		fmt.Fprintf(w, ", %d records dropped by %s", s.Dropped[name], name)
+	}
+	fmt.Fprintln(w)
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
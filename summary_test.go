@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestSummaryMedian(t *testing.T) {
+	for _, tt := range []struct {
+		amounts []int64
+		median  int64
+	}{
+		{[]int64{5}, 5},
+		{[]int64{9, 1, 5}, 5},
+		{[]int64{4, 1, 3, 2}, 2}, // (2+3)/2 rounded down
+	} {
+		summary := NewSummary()
+		for _, amount := range tt.amounts {
+			summary.Add(Transfer{Event: EventTransfer, Amount: big.NewInt(amount)})
+		}
+		summary.Finish()
+		if summary.MedianAmount == nil || summary.MedianAmount.Int64() != tt.median {
+			t.Errorf("median of %v = %v, want %d", tt.amounts, summary.MedianAmount, tt.median)
+		}
+	}
+}
+
+func TestRunningSummaryKeepsNoAmounts(t *testing.T) {
+	summary := NewRunningSummary()
+	for i := int64(1); i <= 1000; i++ {
+		summary.Add(Transfer{Event: EventTransfer, Amount: big.NewInt(i)})
+	}
+	summary.Finish()
+	if len(summary.amounts) != 0 {
+		t.Errorf("kept %d amounts", len(summary.amounts))
+	}
+	if summary.MedianAmount != nil {
+		t.Errorf("median = %s, want none", summary.MedianAmount)
+	}
+	if summary.AverageAmount.Int64() != 500 || summary.Total.Int64() != 500500 {
+		t.Errorf("average %s and total %s, want 500 and 500500", summary.AverageAmount, summary.Total)
+	}
+}
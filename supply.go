@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// isMissingStateErr reports whether err looks like a node refusing a historical
+// state read, i.e. the node isn't an archive node
+func isMissingStateErr(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"missing trie node", "historical state", "state not available", "state is not available", "state histories"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// supplyHistory samples totalSupply() every interval blocks from start to end,
+// plus at end itself, and writes {block, supply} rows. Reading old state
+// requires an archive node.
+func supplyHistory(ctx context.Context, usdc USDC, start uint64, end uint64, interval uint64, opts outputOptions, w io.Writer, format string) error {
+	var blocks []uint64
+	for block := start; block <= end; block += interval {
+		blocks = append(blocks, block)
+		if end-block < interval {
+			break
+		}
+	}
+	if blocks[len(blocks)-1] != end {
+		blocks = append(blocks, end)
+	}
+
+	rows := make([][]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		supply, err := usdc.TotalSupply(&bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)})
+		if err != nil {
+			if isMissingStateErr(err) {
+				log.Printf("WARNING: the node has no state for block %d, supply history requires an archive node", block)
+			}
+			return rpcFailure(fmt.Errorf("Failed to get total supply at block %d: %v", block, err))
+		}
+		rows = append(rows, []interface{}{block, opts.reportAmount(format, supply)})
+	}
+	return writeTable(w, format, []string{"block", "supply"}, rows)
+}
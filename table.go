@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// openReport opens path for a report, or stdout if path is empty
+func openReport(path string) (io.WriteCloser, error) {
+	if path == "" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return createFile(path)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// writeTable writes report rows as csv, ndjson objects keyed by column, or an aligned text table
+func writeTable(w io.Writer, format string, columns []string, rows [][]interface{}) error {
+	switch format {
+	case FORMAT_CSV:
+		header, err := encodeCSV(columns)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			fields := make([]string, len(row))
+			for i, v := range row {
+				fields[i] = fmt.Sprint(v)
+			}
+			record, err := encodeCSV(fields)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FORMAT_NDJSON:
+		// Encode objects by hand to keep the column order
+		for _, row := range rows {
+			var buf bytes.Buffer
+			buf.WriteByte('{')
+			for i, v := range row {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				key, _ := json.Marshal(columns[i])
+				value, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				buf.Write(key)
+				buf.WriteByte(':')
+				buf.Write(value)
+			}
+			buf.WriteString("}\n")
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		fields := make([]string, len(row))
+		for i, v := range row {
+			fields[i] = fmt.Sprint(v)
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Chain ID of Ethereum mainnet, where the built-in USDC definition lives
+const MAINNET_CHAIN_ID = 1
+
+// tokenInfo is one token of a tokenlist.json
+type tokenInfo struct {
+	ChainID  int64  `json:"chainId"`
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Decimals uint8  `json:"decimals"`
+	LogoURI  string `json:"logoURI,omitempty"`
+}
+
+// tokenList is the Uniswap token list schema (https://tokenlists.org), reduced
+// to the fields used here
+type tokenList struct {
+	Name   string      `json:"name"`
+	Tokens []tokenInfo `json:"tokens"`
+}
+
+// defaultTokens is the registry without -token-list
+var defaultTokens = &tokenList{
+	Name: "built-in",
+	Tokens: []tokenInfo{{
+		ChainID:  MAINNET_CHAIN_ID,
+		Address:  USDC_CONTRACT_ADDRESS,
+		Symbol:   "USDC",
+		Name:     "USD Coin",
+		Decimals: USDC_DEFAULT_DECIMALS,
+	}},
+}
+
+// loadTokenList reads a token list from an http(s) URL or a file and validates it
+func loadTokenList(ctx context.Context, source string) (*tokenList, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Failed to fetch %s: %s", source, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	var list tokenList
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, fmt.Errorf("Failed to decode token list %s: %v", source, err)
+	}
+	if err := list.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid token list %s: %v", source, err)
+	}
+	return &list, nil
+}
+
+// validate checks the fields of the schema that resolving tokens relies on
+func (l *tokenList) validate() error {
+	if l.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if len(l.Tokens) == 0 {
+		return fmt.Errorf("no tokens")
+	}
+	for i, token := range l.Tokens {
+		switch {
+		case token.ChainID <= 0:
+			return fmt.Errorf("token %d (%s): invalid chainId %d", i, token.Symbol, token.ChainID)
+		case !common.IsHexAddress(token.Address):
+			return fmt.Errorf("token %d (%s): invalid address %q", i, token.Symbol, token.Address)
+		case token.Symbol == "":
+			return fmt.Errorf("token %d (%s): missing symbol", i, token.Address)
+		}
+	}
+	return nil
+}
+
+// Resolve finds a token of chainID by address, or by case-insensitive symbol.
+// An address that isn't listed resolves to a token without a symbol; a symbol
+// shared by several tokens of the chain is an error.
+func (l *tokenList) Resolve(chainID int64, symbolOrAddress string) (tokenInfo, error) {
+	if common.IsHexAddress(symbolOrAddress) {
+		address := common.HexToAddress(symbolOrAddress)
+		for _, token := range l.Tokens {
+			if token.ChainID == chainID && common.HexToAddress(token.Address) == address {
+				return token, nil
+			}
+		}
+		return tokenInfo{ChainID: chainID, Address: address.Hex()}, nil
+	}
+
+	var found []tokenInfo
+	for _, token := range l.Tokens {
+		if token.ChainID == chainID && strings.EqualFold(token.Symbol, symbolOrAddress) {
+			found = append(found, token)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return tokenInfo{}, badInput(fmt.Errorf("No token %q on chain %d in the %s token list", symbolOrAddress, chainID, l.Name))
+	case 1:
+		return found[0], nil
+	}
+	addresses := make([]string, len(found))
+	for i, token := range found {
+		addresses[i] = token.Address
+	}
+	return tokenInfo{}, badInput(fmt.Errorf("Token symbol %q is ambiguous on chain %d, use one of the addresses %s", symbolOrAddress, chainID, strings.Join(addresses, ", ")))
+}
+
+// lookup returns the tokens of any chain matching an address or case-insensitive symbol
+func (l *tokenList) lookup(symbolOrAddress string) []tokenInfo {
+	var found []tokenInfo
+	for _, token := range l.Tokens {
+		if common.IsHexAddress(symbolOrAddress) && common.HexToAddress(token.Address) == common.HexToAddress(symbolOrAddress) ||
+			strings.EqualFold(token.Symbol, symbolOrAddress) {
+			found = append(found, token)
+		}
+	}
+	return found
+}
+
+// printTokenMetadata prints the registry entry of token (default: USDC). A
+// token listed once is printed without any RPC; one listed on several chains
+// is picked by the chain ID of client. An unlisted address, or a listed one
+// without a name, is completed with on-chain reads.
+func printTokenMetadata(ctx context.Context, w io.Writer, client *ethclient.Client, registry *tokenList, token string, timeout time.Duration) error {
+	if token == "" {
+		token = USDC_CONTRACT_ADDRESS
+	}
+	source := registry.Name + " token list"
+	found := registry.lookup(token)
+	var info tokenInfo
+	switch {
+	case len(found) == 1:
+		info = found[0]
+	case len(found) > 1:
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			return rpcFailure(fmt.Errorf("Failed to get the chain ID: %v", err))
+		}
+		if info, err = registry.Resolve(chainID.Int64(), token); err != nil {
+			return err
+		}
+	case common.IsHexAddress(token):
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			return rpcFailure(fmt.Errorf("Failed to get the chain ID: %v", err))
+		}
+		info = tokenInfo{ChainID: chainID.Int64(), Address: common.HexToAddress(token).Hex()}
+		source = "on-chain calls, not in the " + registry.Name + " token list"
+	default:
+		return badInput(fmt.Errorf("No token %q in the %s token list, pass its address for on-chain metadata", token, registry.Name))
+	}
+
+	if info.Symbol == "" || info.Name == "" {
+		usdc, err := NewUSDC(common.HexToAddress(info.Address), client)
+		if err != nil {
+			return err
+		}
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if info.Symbol == "" {
+			// Unlisted: every field is read on-chain
+			if info.Symbol, err = usdc.SymbolCtx(callCtx); err != nil {
+				return rpcFailure(fmt.Errorf("Failed to get the symbol: %v", err))
+			}
+			if info.Decimals, err = usdc.DecimalsCtx(callCtx); err != nil {
+				return rpcFailure(fmt.Errorf("Failed to get the decimals: %v", err))
+			}
+		}
+		if info.Name, err = usdc.NameCtx(callCtx); err != nil {
+			return rpcFailure(fmt.Errorf("Failed to get the name: %v", err))
+		}
+		if len(found) > 0 {
+			source += ", name from an on-chain call"
+		}
+	}
+
+	fmt.Fprintf(w, "Chain ID: %d\n", info.ChainID)
+	fmt.Fprintf(w, "Address: %s\n", common.HexToAddress(info.Address).Hex())
+	fmt.Fprintf(w, "Symbol: %s\n", info.Symbol)
+	fmt.Fprintf(w, "Name: %s\n", info.Name)
+	fmt.Fprintf(w, "Decimals: %d\n", info.Decimals)
+	if info.LogoURI != "" {
+		fmt.Fprintf(w, "Logo: %s\n", info.LogoURI)
+	}
+	fmt.Fprintf(w, "Source: %s\n", source)
+	return nil
+}
+
+// resolveToken resolves -token on the chain of client; without one it is the built-in USDC
+func resolveToken(ctx context.Context, client *ethclient.Client, registry *tokenList, token string) (tokenInfo, error) {
+	if token == "" {
+		return defaultTokens.Tokens[0], nil
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return tokenInfo{}, rpcFailure(fmt.Errorf("Failed to get the chain ID: %v", err))
+	}
+	return registry.Resolve(chainID.Int64(), token)
+}
+
+// tokenSymbol reads the symbol of an unlisted token, falling back to its address
+func tokenSymbol(ctx context.Context, token USDC, address common.Address, timeout time.Duration) string {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	symbol, err := token.SymbolCtx(ctx)
+	if err != nil || symbol == "" {
+		log.Printf("Failed to get the token symbol, labelling amounts with the address: %v", err)
+		return address.Hex()
+	}
+	return symbol
+}
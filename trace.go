@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ERC20_CALLS_ABI has the state-changing ERC-20 methods USDCABI lacks, to decode traced calls
+const ERC20_CALLS_ABI = `[{"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transferFrom","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}],"name":"approve","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"}]`
+
+var erc20CallsABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(ERC20_CALLS_ABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// decodeCall describes the token method called with input, e.g.
+// "transfer(to=0x..., value=1000000)", or returns false for unknown selectors
+func decodeCall(input []byte) (string, bool) {
+	method, err := erc20CallsABI.MethodById(input[:4])
+	if err != nil {
+		method, err = usdcABI.MethodById(input[:4])
+	}
+	if err != nil {
+		return "", false
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return method.Name, true
+	}
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = fmt.Sprintf("%s=%v", method.Inputs[i].Name, arg)
+	}
+	return method.Name + "(" + strings.Join(parts, ", ") + ")", true
+}
+
+// callFrame is a frame of the geth callTracer output
+type callFrame struct {
+	Type   string         `json:"type"`
+	From   common.Address `json:"from"`
+	To     common.Address `json:"to"`
+	Value  *hexutil.Big   `json:"value"`
+	Input  hexutil.Bytes  `json:"input"`
+	Error  string         `json:"error"`
+	Revert string         `json:"revertReason"`
+	Calls  []callFrame    `json:"calls"`
+}
+
+// traceTransaction fetches the call tree of a transaction with debug_traceTransaction.
+// Only some providers expose the debug namespace, and tracing old transactions
+// usually requires an archive node.
+func traceTransaction(ctx context.Context, client *rpc.Client, hash common.Hash) (*callFrame, error) {
+	var frame callFrame
+	err := client.CallContext(ctx, &frame, "debug_traceTransaction", hash, map[string]string{"tracer": "callTracer"})
+	if err != nil {
+		return nil, err
+	}
+	return &frame, nil
+}
+
+// isMethodNotFound reports whether err is a JSON-RPC "method not found" error
+func isMethodNotFound(err error) bool {
+	if rpcErr, ok := err.(rpc.Error); ok && rpcErr.ErrorCode() == -32601 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "method not found") || strings.Contains(msg, "does not exist")
+}
+
+// traceSink prints the call context of the transaction of each record the
+// first time it is seen: the frames leading to calls into the token contract
+// and any internal ETH transfers, with the rest of the call tree pruned. A
+// failing trace is logged and skipped; a provider without debug_traceTransaction
+// disables tracing.
+type traceSink struct {
+	ctx      context.Context
+	client   *rpc.Client
+	token    common.Address
+	w        io.Writer
+	seen     map[common.Hash]struct{}
+	disabled bool
+}
+
+// withTrace also prints the call context of sink's records if enabled
+func withTrace(ctx context.Context, sink Sink, client *rpc.Client, token common.Address, enabled bool) Sink {
+	if !enabled {
+		return sink
+	}
+	return multiSink{sink, &traceSink{ctx: ctx, client: client, token: token, w: infoOut, seen: make(map[common.Hash]struct{})}}
+}
+
+func (s *traceSink) Write(t Transfer) error {
+	if s.disabled {
+		return nil
+	}
+	if _, ok := s.seen[t.TxHash]; ok {
+		return nil
+	}
+	s.seen[t.TxHash] = struct{}{}
+
+	frame, err := traceTransaction(s.ctx, s.client, t.TxHash)
+	if err != nil && isMethodNotFound(err) {
+		log.Printf("WARNING: the provider doesn't support debug_traceTransaction, -with-trace is disabled: %v", err)
+		s.disabled = true
+		return nil
+	}
+	if err != nil {
+		log.Printf("WARNING: failed to trace tx %s: %v", t.TxHash.Hex(), err)
+		return nil
+	}
+
+	fmt.Fprintf(s.w, "  Trace of tx %s:\n", t.TxHash.Hex())
+	s.printFrame(frame, 2)
+	return nil
+}
+
+// relevant reports whether frame calls the token or moves ETH, or leads to a frame that does
+func (s *traceSink) relevant(frame *callFrame) bool {
+	if frame.To == s.token || ethValue(frame).Sign() > 0 {
+		return true
+	}
+	for i := range frame.Calls {
+		if s.relevant(&frame.Calls[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// printFrame prints frame and its relevant children, indented by depth
+func (s *traceSink) printFrame(frame *callFrame, depth int) {
+	line := fmt.Sprintf("%s%s %s -> %s", strings.Repeat("  ", depth), frame.Type, frame.From.Hex(), frame.To.Hex())
+	if len(frame.Input) >= 4 {
+		if call, ok := decodeCall(frame.Input); ok && frame.To == s.token {
+			line += " " + call
+		} else {
+			line += " " + hexutil.Encode(frame.Input[:4])
+		}
+	}
+	if value := ethValue(frame); value.Sign() > 0 {
+		line += fmt.Sprintf(", value %s ETH", formatAmount(value, 18))
+	}
+	if frame.Error != "" {
+		line += ", error: " + frame.Error
+		if frame.Revert != "" {
+			line += " (" + frame.Revert + ")"
+		}
+	}
+	fmt.Fprintln(s.w, line)
+
+	for i := range frame.Calls {
+		if s.relevant(&frame.Calls[i]) {
+			s.printFrame(&frame.Calls[i], depth+1)
+		}
+	}
+}
+
+func (s *traceSink) Close() error {
+	return nil
+}
+
+// ethValue is the wei value of a frame, zero if none
+func ethValue(frame *callFrame) *big.Int {
+	if frame.Value == nil {
+		return new(big.Int)
+	}
+	return frame.Value.ToInt()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Approval event signature
+const APPROVAL_EVENT_SIGNATURE = "Approval(address,address,uint256)"
+
+// Event topics
+var (
+	transferTopic = crypto.Keccak256Hash([]byte(TRANSFER_EVENT_SIGNATURE))
+	approvalTopic = crypto.Keccak256Hash([]byte(APPROVAL_EVENT_SIGNATURE))
+)
+
+// usdcABI is USDCABI parsed once, for decoding logs
+var usdcABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(USDCABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// verifyEventTopics checks the topics computed from the hardcoded event
+// signatures against the event IDs of the ABI, since a typo in a signature
+// would silently match no logs. It returns a warning per mismatch.
+func verifyEventTopics() []string {
+	var warnings []string
+	for name, topic := range map[string]common.Hash{"Transfer": transferTopic, "Approval": approvalTopic} {
+		event, ok := usdcABI.Events[name]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("the ABI has no %s event", name))
+		} else if event.ID != topic {
+			warnings = append(warnings, fmt.Sprintf("the %s topic %s doesn't match the ABI event %s with topic %s", name, topic.Hex(), event.Sig, event.ID.Hex()))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// EventKind identifies which USDC event a record was decoded from
+type EventKind string
+
+const (
+	EventTransfer EventKind = "Transfer"
+	EventApproval EventKind = "Approval"
+)
+
+// Transfer is a decoded USDC Transfer event. For Approval events From is the
+// owner, To the spender and Amount the allowance.
+type Transfer struct {
+	Event       EventKind
+	BlockNumber uint64
+	TxHash      common.Hash
+	LogIndex    uint
+	Type        string
+	From        common.Address
+	To          common.Address
+	Amount      *big.Int
+}
+
+// errUnexpectedTopics marks logs that don't look like a standard Transfer or Approval and are skipped
+var errUnexpectedTopics = errors.New("unexpected topics")
+
+// decodeLog decodes a Transfer or Approval log, dispatching on its first topic.
+// The fields are unpacked with the event's ABI, indexed addresses included.
+func decodeLog(vLog types.Log) (Transfer, error) {
+	if len(vLog.Topics) != 3 {
+		return Transfer{}, errUnexpectedTopics
+	}
+	if len(vLog.Data) != 32 {
+		return Transfer{}, fmt.Errorf("Failed to decode log %s/%d: unexpected data length %d", vLog.TxHash.Hex(), vLog.Index, len(vLog.Data))
+	}
+
+	t := Transfer{
+		BlockNumber: vLog.BlockNumber,
+		TxHash:      vLog.TxHash,
+		LogIndex:    vLog.Index,
+	}
+	switch vLog.Topics[0] {
+	case transferTopic:
+		t.Event = EventTransfer
+	case approvalTopic:
+		t.Event = EventApproval
+	default:
+		return Transfer{}, errUnexpectedTopics
+	}
+
+	// Transfer(from, to, value) and Approval(owner, spender, value) share one layout
+	event := usdcABI.Events[string(t.Event)]
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	values := make(map[string]interface{})
+	if err := abi.ParseTopicsIntoMap(values, indexed, vLog.Topics[1:]); err != nil {
+		return Transfer{}, fmt.Errorf("Failed to decode log %s/%d topics: %v", vLog.TxHash.Hex(), vLog.Index, err)
+	}
+	if err := usdcABI.UnpackIntoMap(values, event.Name, vLog.Data); err != nil {
+		return Transfer{}, fmt.Errorf("Failed to decode log %s/%d data: %v", vLog.TxHash.Hex(), vLog.Index, err)
+	}
+	t.From = values[event.Inputs[0].Name].(common.Address)
+	t.To = values[event.Inputs[1].Name].(common.Address)
+	t.Amount = values[event.Inputs[2].Name].(*big.Int)
+
+	t.Type = string(t.Event)
+	if t.Event == EventTransfer && t.From == (common.Address{}) {
+		t.Type = "Mint"
+	}
+	return t, nil
+}
+
+// formatAmount formats a raw token amount as a decimal string without losing precision
+func formatAmount(amount *big.Int, decimals uint8) string {
+	divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(amount, divisor, new(big.Int))
+	if frac.Sign() == 0 {
+		return whole.String()
+	}
+
+	fracStr := frac.String()
+	fracStr = strings.Repeat("0", int(decimals)-len(fracStr)) + fracStr
+	return whole.String() + "." + strings.TrimRight(fracStr, "0")
+}
+
+// roundAmount formats a raw token amount with exactly precision fractional digits,
+// rounding to nearest with halves rounded away from zero
+func roundAmount(amount *big.Int, decimals uint8, precision int) string {
+	divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(amount, divisor).FloatString(precision)
+}
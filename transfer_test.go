@@ -0,0 +1,236 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	testAlice = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	testBob   = common.HexToAddress("0x2222222222222222222222222222222222222222")
+)
+
+// testLog builds a Transfer or Approval log as eth_getLogs returns it
+func testLog(topic common.Hash, from common.Address, to common.Address, amount int64, block uint64, index uint) types.Log {
+	return types.Log{
+		Address:     common.HexToAddress(USDC_CONTRACT_ADDRESS),
+		Topics:      []common.Hash{topic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+		Data:        common.LeftPadBytes(big.NewInt(amount).Bytes(), 32),
+		BlockNumber: block,
+		TxHash:      common.BigToHash(new(big.Int).SetUint64(block)),
+		Index:       index,
+	}
+}
+
+func TestFilterQueryApprovals(t *testing.T) {
+	query := scanConfig{WithApprovals: true}.filterQuery()
+	if len(query.Topics) != 1 || len(query.Topics[0]) != 2 || query.Topics[0][0] != transferTopic || query.Topics[0][1] != approvalTopic {
+		t.Fatalf("Topics = %v, want one OR set of the Transfer and Approval topics", query.Topics)
+	}
+	query = scanConfig{}.filterQuery()
+	if len(query.Topics) != 1 || len(query.Topics[0]) != 1 || query.Topics[0][0] != transferTopic {
+		t.Fatalf("Topics = %v, want only the Transfer topic", query.Topics)
+	}
+}
+
+func TestDecodeMixedLogs(t *testing.T) {
+	logs := []types.Log{
+		testLog(transferTopic, common.Address{}, testAlice, 5_000_000, 10, 0),
+		testLog(approvalTopic, testAlice, testBob, 7_000_000, 10, 1),
+		testLog(transferTopic, testAlice, testBob, 2_000_000, 11, 0),
+	}
+	want := []struct {
+		event  EventKind
+		typ    string
+		from   common.Address
+		to     common.Address
+		amount int64
+	}{
+		{EventTransfer, "Mint", common.Address{}, testAlice, 5_000_000},
+		{EventApproval, "Approval", testAlice, testBob, 7_000_000},
+		{EventTransfer, "Transfer", testAlice, testBob, 2_000_000},
+	}
+
+	for i, vLog := range logs {
+		got, err := decodeLog(vLog)
+		if err != nil {
+			t.Fatalf("log %d: %v", i, err)
+		}
+		w := want[i]
+		if got.Event != w.event || got.Type != w.typ || got.From != w.from || got.To != w.to || got.Amount.Int64() != w.amount {
+			t.Errorf("log %d = %+v, want %+v", i, got, w)
+		}
+		if got.BlockNumber != vLog.BlockNumber || got.LogIndex != vLog.Index || got.TxHash != vLog.TxHash {
+			t.Errorf("log %d has position %d/%d %s, want %d/%d %s", i, got.BlockNumber, got.LogIndex, got.TxHash.Hex(), vLog.BlockNumber, vLog.Index, vLog.TxHash.Hex())
+		}
+	}
+
+	var records collectSink
+	summary := NewSummary()
+	if err := processLogs(logs, scanConfig{}, &records, summary); err != nil {
+		t.Fatal(err)
+	}
+	summary.Finish()
+	if len(records) != 3 || summary.Count != 2 || summary.Approvals != 1 {
+		t.Fatalf("got %d records, %d transfers and %d approvals, want 3, 2 and 1", len(records), summary.Count, summary.Approvals)
+	}
+	if summary.Total.Int64() != 7_000_000 {
+		t.Errorf("volume = %s, want 7000000 without the approval", summary.Total)
+	}
+}
+
+func TestDecodeUnexpectedTopics(t *testing.T) {
+	vLog := testLog(common.HexToHash("0x01"), testAlice, testBob, 1, 10, 0)
+	if _, err := decodeLog(vLog); err != errUnexpectedTopics {
+		t.Errorf("unknown topic: err = %v, want errUnexpectedTopics", err)
+	}
+	vLog = testLog(transferTopic, testAlice, testBob, 1, 10, 0)
+	vLog.Topics = vLog.Topics[:2]
+	if _, err := decodeLog(vLog); err != errUnexpectedTopics {
+		t.Errorf("2 topics: err = %v, want errUnexpectedTopics", err)
+	}
+}
+
+func TestRoundAmount(t *testing.T) {
+	for _, tt := range []struct {
+		amount    int64
+		precision int
+		want      string
+	}{
+		{1_005_000, 2, "1.01"}, // half rounds away from zero
+		{1_004_999, 2, "1.00"},
+		{995_000, 2, "1.00"},
+		{9_995_000, 2, "10.00"},
+		{500_000, 0, "1"},
+		{499_999, 0, "0"},
+		{1_234_567, 6, "1.234567"},
+		{1_500_000, 8, "1.50000000"},
+		{0, 2, "0.00"},
+	} {
+		if got := roundAmount(big.NewInt(tt.amount), 6, tt.precision); got != tt.want {
+			t.Errorf("roundAmount(%d, 6, %d) = %s, want %s", tt.amount, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	big18, _ := new(big.Int).SetString("1000000000000000001", 10)
+	for _, tt := range []struct {
+		amount   *big.Int
+		decimals uint8
+		want     string
+	}{
+		{big.NewInt(1_500_000), 6, "1.5"},
+		{big.NewInt(1_000_000), 6, "1"},
+		{big.NewInt(1), 6, "0.000001"},
+		{big18, 18, "1.000000000000000001"},
+		{big.NewInt(42), 0, "42"},
+	} {
+		if got := formatAmount(tt.amount, tt.decimals); got != tt.want {
+			t.Errorf("formatAmount(%s, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestPrecisionKeepsJSONExact(t *testing.T) {
+	transfer := Transfer{Event: EventTransfer, Type: "Transfer", Amount: big.NewInt(1_234_567)}
+	opts := outputOptions{Decimals: 6, Precision: 2, CSVPrecision: -1}
+	text, err := encodeTransfer(FORMAT_TEXT, transfer, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "amount: 1.23 ") {
+		t.Errorf("text = %q, want the amount rounded to 1.23", text)
+	}
+	record, err := encodeTransfer(FORMAT_NDJSON, transfer, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(record), `"1.234567"`) || !strings.Contains(string(record), `"1234567"`) {
+		t.Errorf("ndjson = %s, want the exact amounts", record)
+	}
+}
+
+// manualDecode reads a log the way decodeLog did before it used the ABI
+func manualDecode(vLog types.Log) (from common.Address, to common.Address, amount *big.Int) {
+	return common.BytesToAddress(vLog.Topics[1].Bytes()), common.BytesToAddress(vLog.Topics[2].Bytes()), new(big.Int).SetBytes(vLog.Data)
+}
+
+func TestDecodeLogMatchesManualDecode(t *testing.T) {
+	maxAmount := testLog(transferTopic, testAlice, testBob, 0, 12, 0)
+	maxAmount.Data = common.FromHex("0x" + strings.Repeat("ff", 32))
+	for i, vLog := range []types.Log{
+		testLog(transferTopic, testAlice, testBob, 1, 10, 0),
+		testLog(transferTopic, common.Address{}, testAlice, 0, 10, 1),
+		testLog(approvalTopic, testBob, testAlice, 123_456_789, 11, 0),
+		testLog(transferTopic, common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff"), testBob, 1<<62, 11, 1),
+		maxAmount,
+	} {
+		got, err := decodeLog(vLog)
+		if err != nil {
+			t.Fatalf("log %d: %v", i, err)
+		}
+		from, to, amount := manualDecode(vLog)
+		if got.From != from || got.To != to || got.Amount.Cmp(amount) != 0 {
+			t.Errorf("log %d = %s -> %s %s, want %s -> %s %s", i, got.From.Hex(), got.To.Hex(), got.Amount, from.Hex(), to.Hex(), amount)
+		}
+	}
+}
+
+func BenchmarkDecodeLog(b *testing.B) {
+	vLog := testLog(transferTopic, testAlice, testBob, 2_000_000, 10, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeLog(vLog); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkManualDecode(b *testing.B) {
+	vLog := testLog(transferTopic, testAlice, testBob, 2_000_000, 10, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		manualDecode(vLog)
+	}
+}
+
+func TestTextAmountUnits(t *testing.T) {
+	billion18, _ := new(big.Int).SetString("1000000000000000000000000000", 10)
+	for _, tt := range []struct {
+		amount    *big.Int
+		decimals  uint8
+		unit      string
+		precision int
+		want      string
+	}{
+		{big.NewInt(1_500_000), 6, UNIT_BASE, -1, "1.5"},
+		{big.NewInt(994_999_999), 6, UNIT_THOUSANDS, -1, "0.99K"},
+		{big.NewInt(995_000_000), 6, UNIT_THOUSANDS, -1, "1.00K"}, // 995 rounds up to 1K
+		{big.NewInt(1_000_000_000), 6, UNIT_THOUSANDS, -1, "1.00K"},
+		{big.NewInt(999_000_000), 6, UNIT_MILLIONS, -1, "0.00M"},
+		{big.NewInt(999_999_000_000), 6, UNIT_MILLIONS, -1, "1.00M"},
+		{big.NewInt(1_500_000_000_000), 6, UNIT_MILLIONS, -1, "1.50M"},
+		{big.NewInt(999_994_999_999_999), 6, UNIT_BILLIONS, -1, "1.00B"},
+		{big.NewInt(2_500_000_000_000_000), 6, UNIT_BILLIONS, -1, "2.50B"},
+		{big.NewInt(1_234_500_000_000_000), 6, UNIT_BILLIONS, 4, "1.2345B"},
+		{big.NewInt(1_500_000_000_000_000), 6, UNIT_BILLIONS, 0, "2B"},
+		{big.NewInt(0), 6, UNIT_MILLIONS, -1, "0.00M"},
+		{billion18, 18, UNIT_BILLIONS, -1, "1.00B"},
+	} {
+		opts := outputOptions{Decimals: tt.decimals, Unit: tt.unit, Precision: tt.precision}
+		if got := opts.textAmount(tt.amount); got != tt.want {
+			t.Errorf("textAmount(%s) with -unit %s and -precision %d = %s, want %s", tt.amount, tt.unit, tt.precision, got, tt.want)
+		}
+	}
+
+	// csv and ndjson stay unscaled
+	opts := outputOptions{Decimals: 6, Unit: UNIT_MILLIONS, Precision: -1, CSVPrecision: -1}
+	if got := opts.reportAmount(FORMAT_CSV, big.NewInt(1_500_000_000_000)); got != "1500000" {
+		t.Errorf("csv report amount = %s, want 1500000", got)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// watchConfig controls watch mode
+type watchConfig struct {
+	Scan         scanConfig
+	PollInterval time.Duration
+	ReorgDepth   uint64
+	DedupeWindow uint64
+	// How often to log the head lag; zero disables the log line
+	HeadLagInterval time.Duration
+	// Adapt the polling interval to the observed block time, within [MinPoll, MaxPoll]
+	Adaptive bool
+	MinPoll  time.Duration
+	MaxPoll  time.Duration
+}
+
+// Watch mode freshness gauges, served with the other expvars on -metrics
+var (
+	headLagBlocks  = expvar.NewInt("head_lag_blocks")
+	headLagSeconds = expvar.NewInt("head_lag_seconds")
+)
+
+// headerReader is implemented by *ethclient.Client
+type headerReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// watchTransfers scans from cfg.Scan.StartBlock to the head, then keeps polling
+// for new blocks until ctx is cancelled. Each poll re-scans the last ReorgDepth
+// blocks to pick up logs that moved in a reorg; logs seen before are dropped.
+// RPC errors are logged and retried on the next poll. The summary covers
+// everything emitted until ctx was cancelled.
+func watchTransfers(ctx context.Context, client headerReader, logs logFilterer, cfg watchConfig, sink Sink) (*Summary, error) {
+	query := cfg.Scan.filterQuery()
+	summary := NewRunningSummary()
+	seen := newDedupeSet(cfg.DedupeWindow)
+	next := cfg.Scan.StartBlock
+	scanned := false
+	var processedTime uint64
+	lastLagLog := time.Now()
+	poll := &adaptivePoll{min: cfg.MinPoll, max: cfg.MaxPoll, current: cfg.PollInterval}
+
+	for {
+		header, err := client.HeaderByNumber(ctx, nil)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to get the latest block number: %v", err)
+		}
+
+		if err == nil && header.Number.Uint64() >= next {
+			head := header.Number.Uint64()
+			start, from := next, next
+			if scanned {
+				from = max(cfg.Scan.StartBlock, next-min(next, cfg.ReorgDepth))
+			}
+
+			err = forEachChunk(from, head, cfg.Scan.ChunkSize, func(from uint64, to uint64) error {
+				chunk, err := fetchChunk(ctx, logs, query, from, to, cfg.Scan.RetryOnEmpty)
+				if err != nil {
+					return err
+				}
+				// A log only counts as seen once processed, so the logs
+				// after a failed one are emitted when the chunk is retried
+				for _, vLog := range chunk {
+					key := dedupeKey{vLog.TxHash, vLog.Index}
+					if seen.Has(vLog.BlockNumber, key) {
+						continue
+					}
+					if err := processLogs([]types.Log{vLog}, cfg.Scan, sink, summary); err != nil {
+						return err
+					}
+					seen.Add(vLog.BlockNumber, key)
+				}
+				// Resume after this chunk even if a later one fails, since
+				// its logs may fall out of the dedupe window before the retry
+				next = max(next, to+1)
+				scanned = true
+				return nil
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Failed to scan blocks %d-%d: %v", next, head, err)
+			}
+			if next == head+1 {
+				processedTime = header.Time
+			} else if next > start {
+				if processed, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(next-1)); err == nil {
+					processedTime = processed.Time
+				}
+			}
+		}
+
+		if cfg.Adaptive && header != nil {
+			poll.Observe(header.Number.Uint64(), header.Time)
+		}
+
+		// Lag of the last processed block behind the current head
+		if header != nil && scanned {
+			headLagBlocks.Set(int64(header.Number.Uint64() - (next - 1)))
+			headLagSeconds.Set(int64(header.Time - processedTime))
+			if cfg.HeadLagInterval > 0 && time.Since(lastLagLog) >= cfg.HeadLagInterval {
+				log.Printf("Head lag: %d blocks, %ds", headLagBlocks.Value(), headLagSeconds.Value())
+				lastLagLog = time.Now()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			summary.Finish()
+			return summary, nil
+		case <-time.After(poll.current):
+		}
+	}
+}
+
+// adaptivePoll adapts the watch polling interval to the chain: it follows the
+// block time measured between polls that saw new blocks, and backs off by
+// half while the head doesn't move, always within [min, max]
+type adaptivePoll struct {
+	min, max   time.Duration
+	current    time.Duration
+	lastNumber uint64
+	lastTime   uint64
+}
+
+// Observe records the head seen by a poll and updates the interval
+func (p *adaptivePoll) Observe(number uint64, timestamp uint64) {
+	switch {
+	case p.lastNumber == 0:
+	case number > p.lastNumber && timestamp > p.lastTime:
+		p.current = time.Duration(timestamp-p.lastTime) * time.Second / time.Duration(number-p.lastNumber)
+	case number == p.lastNumber:
+		p.current += p.current / 2
+	}
+	p.current = min(max(p.current, p.min), p.max)
+	if number >= p.lastNumber {
+		p.lastNumber, p.lastTime = number, timestamp
+	}
+}
+
+// dedupeKey identifies a log across polls
+type dedupeKey struct {
+	TxHash common.Hash
+	Index  uint
+}
+
+// dedupeSet remembers which logs were already emitted. With a window of N
+// blocks it only keeps the keys of the last N blocks in a ring of per-block
+// sets, since reorgs can't reach further back; a zero window keeps every key.
+type dedupeSet struct {
+	window uint64
+	all    map[dedupeKey]struct{}
+	ring   []dedupeBlock
+	newest uint64
+}
+
+type dedupeBlock struct {
+	number uint64
+	keys   map[dedupeKey]struct{}
+}
+
+func newDedupeSet(window uint64) *dedupeSet {
+	if window == 0 {
+		return &dedupeSet{all: make(map[dedupeKey]struct{})}
+	}
+	return &dedupeSet{window: window, ring: make([]dedupeBlock, window)}
+}
+
+// Has reports whether key was recorded for block
+func (d *dedupeSet) Has(block uint64, key dedupeKey) bool {
+	if d.window == 0 {
+		_, ok := d.all[key]
+		return ok
+	}
+	slot := &d.ring[block%d.window]
+	if block+d.window <= d.newest || slot.number != block {
+		return false
+	}
+	_, ok := slot.keys[key]
+	return ok
+}
+
+// Add records key for block
+func (d *dedupeSet) Add(block uint64, key dedupeKey) {
+	if d.window == 0 {
+		d.all[key] = struct{}{}
+		return
+	}
+
+	// Blocks that fell out of the window can't be tracked without evicting newer ones
+	if block+d.window <= d.newest {
+		return
+	}
+	d.newest = max(d.newest, block)
+
+	slot := &d.ring[block%d.window]
+	if slot.keys == nil || slot.number != block {
+		slot.number = block
+		slot.keys = make(map[dedupeKey]struct{})
+	}
+	slot.keys[key] = struct{}{}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fixedHead is a chain whose head never moves
+type fixedHead uint64
+
+func (h fixedHead) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		number = new(big.Int).SetUint64(uint64(h))
+	}
+	return &types.Header{Number: number, Time: number.Uint64() * 12}, nil
+}
+
+// flakySink fails its failAt-th write once, like a sink hitting a transient error
+type flakySink struct {
+	collectSink
+	writes int
+	failAt int
+}
+
+func (s *flakySink) Write(t Transfer) error {
+	s.writes++
+	if s.writes == s.failAt {
+		return errors.New("temporarily unavailable")
+	}
+	return s.collectSink.Write(t)
+}
+
+func TestWatchRetriesRecordsAfterSinkFailure(t *testing.T) {
+	node := fakeLogs(func(q ethereum.FilterQuery) ([]types.Log, error) {
+		return []types.Log{
+			testLog(transferTopic, testAlice, testBob, 1_000_000, 5, 0),
+			testLog(transferTopic, testBob, testAlice, 2_000_000, 6, 0),
+		}, nil
+	})
+	sink := &flakySink{failAt: 2}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	summary, err := watchTransfers(ctx, fixedHead(10), node, watchConfig{
+		Scan:         scanConfig{StartBlock: 0, EndBlock: 10, ChunkSize: 100},
+		PollInterval: 10 * time.Millisecond,
+		ReorgDepth:   3,
+		DedupeWindow: 64,
+	}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.collectSink) != 2 || sink.collectSink[0].BlockNumber != 5 || sink.collectSink[1].BlockNumber != 6 {
+		t.Fatalf("sink got %+v, want the records of blocks 5 and 6 once each", sink.collectSink)
+	}
+	if summary.Count != 2 {
+		t.Errorf("summary counted %d transfers, want 2", summary.Count)
+	}
+}